@@ -0,0 +1,167 @@
+package beanstalk
+
+import (
+	"context"
+	"time"
+)
+
+// A PutRequest describes a job to be put by Tube.PutBatch.
+type PutRequest struct {
+	Body  []byte
+	Pri   uint32
+	Delay time.Duration
+	TTR   time.Duration
+}
+
+// A PutResult is the outcome of one PutRequest. Err is a ConnError
+// if the server refused the job, or if it was buried for lack of
+// memory, in which case Id is still set.
+type PutResult struct {
+	Id  uint64
+	Err error
+}
+
+// PutBatch puts the jobs described by jobs into t. It writes all the
+// put commands in one go, preceded by at most one use command, and
+// reads their responses as they arrive, so the whole batch costs about
+// one round trip.
+// The results are in the same order as jobs. The error is non-nil only
+// if the batch as a whole failed, such as when the connection broke;
+// the results of the jobs whose responses were read before then are
+// still returned. The jobs without a result may have been inserted
+// nonetheless: if the context of PutBatchContext is done once the
+// batch has been sent, the error can come with no results at all even
+// though every job is on the server.
+func (t *Tube) PutBatch(jobs []PutRequest) ([]PutResult, error) {
+	return t.PutBatchContext(context.Background(), jobs)
+}
+
+// PutBatchContext is like PutBatch, but takes a context.
+func (t *Tube) PutBatchContext(ctx context.Context, jobs []PutRequest) ([]PutResult, error) {
+	if len(jobs) == 0 {
+		return nil, nil
+	}
+	bodies := make([][]byte, len(jobs))
+	claims := make([][]claim, len(jobs))
+	for i, j := range jobs {
+		body, cl, err := t.Conn.encodeJob(ctx, t.Name, nil, j.Body)
+		if err != nil {
+			for _, cl := range claims[:i] {
+				dropClaims(ctx, cl)
+			}
+			return nil, err
+		}
+		bodies[i], claims[i] = body, cl
+	}
+	results := make([]PutResult, 0, len(jobs))
+	written := 0
+	_, err := t.Conn.pipelineBatch(ctx, t, "put", len(jobs), func(i int) {
+		written = i + 1
+		j := jobs[i]
+		t.Conn.print("put", "", uint64(j.Pri), dur(j.Delay), dur(j.TTR), uint64(len(bodies[i])))
+		t.Conn.w.Write(crnl)
+		t.Conn.w.Write(bodies[i])
+		t.Conn.w.Write(crnl)
+	}, func(i int, header []byte) {
+		id, err := t.Conn.parsePut("put", header)
+		if notStored(err) {
+			dropClaims(ctx, claims[i])
+		}
+		results = append(results, PutResult{id, err})
+	})
+	if err != nil {
+		// The jobs that were never written cannot be on the server.
+		for _, cl := range claims[written:] {
+			dropClaims(ctx, cl)
+		}
+	}
+	return results, err
+}
+
+// pipelineBatch sends n commands for op, written by write and preceded
+// by the use command for t if t is not nil and one is needed, all in
+// one go. Once a write has failed, write is not called for the
+// commands left. It passes the header of each response in turn to
+// read, reading them as they arrive. It returns the number of responses
+// read, and an error if the batch as a whole failed.
+func (c *Conn) pipelineBatch(ctx context.Context, t *Tube, op string, n int, write func(i int), read func(i int, header []byte)) (int, error) {
+	r, err := c.startRequest(ctx, op)
+	if err != nil {
+		return 0, err
+	}
+	r.skip, err = c.adjustTubes(t, nil)
+	if err != nil {
+		c.p.SkipResponse(r.id)
+		c.p.EndRequest(r.id)
+		return 0, err
+	}
+
+	// Read the responses while the commands are still being written,
+	// lest the server stop reading a large batch until we read the
+	// responses it has queued up.
+	type result struct {
+		n   int
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		n, err := c.readBatch(ctx, r, n, read)
+		done <- result{n, err}
+	}()
+
+	// The writer passes what does not fit on to the connection, so
+	// watch the writes and not just the flush.
+	stop := c.watchWrite(ctx)
+	for i := 0; i < n; i++ {
+		if _, err := c.w.Write(nil); err != nil {
+			break // an earlier write failed; the rest would be lost
+		}
+		write(i)
+	}
+	werr := c.flush(ctx, op)
+	stop()
+	if werr != nil {
+		// The responses will never come, and the failed write has left
+		// c unusable. Close the connection so that the reader cannot
+		// block on it, whatever its deadlines say, and keep the request
+		// turn until the reader is done, so that no reconnect replaces
+		// the connection under it.
+		c.mu.Lock()
+		rwc := c.c
+		c.mu.Unlock()
+		rwc.Close()
+		res := <-done
+		c.p.EndRequest(r.id)
+		return res.n, werr
+	}
+	c.p.EndRequest(r.id)
+	res := <-done
+	return res.n, res.err
+}
+
+// readBatch reads the responses to a batch of n commands sent as r.
+// If ctx is done before the first of them is read, it returns 0 and
+// the error, whether or not the commands reached the server.
+func (c *Conn) readBatch(ctx context.Context, r req, n int, read func(i int, header []byte)) (int, error) {
+	err := c.startResponseDiscard(ctx, r, func() {
+		for i := 0; i < n; i++ {
+			if _, _, err := c.readRawResp(context.Background(), r, false); err != nil {
+				return
+			}
+			r.skip = 0
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer c.p.EndResponse(r.id)
+	for i := 0; i < n; i++ {
+		header, _, err := c.readRawResp(ctx, r, false)
+		if err != nil {
+			return i, err
+		}
+		r.skip = 0
+		read(i, header)
+	}
+	return n, nil
+}
@@ -0,0 +1,134 @@
+package beanstalk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestPutBatch(t *testing.T) {
+	c := NewConn(mock(
+		"use a\r\nput 0 0 60 1\r\nx\r\nput 1 0 60 1\r\ny\r\nput 2 5 60 1\r\nz\r\n",
+		"USING a\r\nINSERTED 1\r\nBURIED 2\r\nJOB_TOO_BIG\r\n",
+	))
+	tube := &Tube{c, "a"}
+	res, err := tube.PutBatch([]PutRequest{
+		{Body: []byte("x"), Pri: 0, TTR: time.Minute},
+		{Body: []byte("y"), Pri: 1, TTR: time.Minute},
+		{Body: []byte("z"), Pri: 2, Delay: 5 * time.Second, TTR: time.Minute},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 3 {
+		t.Fatal("expected 3 results, got", len(res))
+	}
+	if res[0].Id != 1 || res[0].Err != nil {
+		t.Fatalf("got %+v", res[0])
+	}
+	if res[1].Id != 2 || !errors.Is(res[1].Err, ErrBuried) {
+		t.Fatalf("got %+v", res[1])
+	}
+	if _, ok := res[2].Err.(ConnError); !ok || !errors.Is(res[2].Err, ErrJobTooBig) {
+		t.Fatalf("got %+v", res[2])
+	}
+}
+
+func TestPutBatchBrokenConn(t *testing.T) {
+	c := NewConn(mock(
+		"put 0 0 0 1\r\nx\r\nput 0 0 0 1\r\ny\r\n",
+		"INSERTED 1\r\n",
+	))
+	res, err := c.PutBatch([]PutRequest{{Body: []byte("x")}, {Body: []byte("y")}})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if len(res) != 1 || res[0].Id != 1 {
+		t.Fatalf("expected first result, got %+v", res)
+	}
+}
+
+func TestPutBatchDeadlineDuringWrite(t *testing.T) {
+	cli, srv := net.Pipe()
+	defer srv.Close() // never read
+	c := NewConn(cli)
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	jobs := make([]PutRequest, 100)
+	for i := range jobs {
+		jobs[i].Body = make([]byte, 1000)
+	}
+	_, err := c.PutBatchContext(ctx, jobs)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal("expected context.DeadlineExceeded, got", err)
+	}
+}
+
+func TestPutBatchWriteTimeout(t *testing.T) {
+	cli, srv := net.Pipe()
+	defer srv.Close() // never read
+	c := NewConn(cli)
+	c.wTimeout = 20 * time.Millisecond
+	defer c.Close()
+
+	// A context that can be canceled, but is not, has the reader watch
+	// it; the failed write must still wake the reader.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	jobs := make([]PutRequest, 100)
+	for i := range jobs {
+		jobs[i].Body = make([]byte, 1000)
+	}
+	errc := make(chan error, 1)
+	go func() {
+		_, err := c.PutBatchContext(ctx, jobs)
+		errc <- err
+	}()
+	select {
+	case err := <-errc:
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("PutBatch blocked after its write timed out")
+	}
+}
+
+func TestPutBatchMany(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	s := newMockServer()
+	go s.serveListener(l)
+	c, err := Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	jobs := make([]PutRequest, 20000)
+	for i := range jobs {
+		jobs[i] = PutRequest{Body: []byte(fmt.Sprint(i)), TTR: time.Minute}
+	}
+	res, err := (&Tube{c, "a"}).PutBatch(jobs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, r := range res {
+		if r.Err != nil {
+			t.Fatal(r.Err)
+		}
+		if j := s.job(r.Id); j == nil || string(j.body) != fmt.Sprint(i) || j.tube != "a" {
+			t.Fatalf("job %d: got %+v", i, j)
+		}
+	}
+	if p, err := c.Peek(res[0].Id); err != nil || string(p) != "0" {
+		t.Fatal("expected Conn to stay in step, got", p, err)
+	}
+}
@@ -0,0 +1,189 @@
+package beanstalk
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// A BlobStore stores the bodies offloaded by a ClaimCheck, by key.
+type BlobStore interface {
+	Put(ctx context.Context, key string, data []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+
+	// Delete removes the blob with the given key. It is not an error
+	// if there is no such blob.
+	Delete(ctx context.Context, key string) error
+}
+
+// A claim-check body is the magic followed by the key of the blob.
+var claimMagic = []byte("\x00BJC")
+
+// A ClaimCheck is a Transformer that stores bodies larger than
+// Threshold in Store, and puts a reference to them in their place, so
+// that jobs can be larger than the max-job-size of the server. The
+// reference is resolved when the job is reserved or peeked.
+//
+// The blob is removed from Store when the job is deleted through the
+// Conn that reserved it, with Delete, DeleteMany or Job.Delete, when
+// it is deleted by Tube.Purge on a Conn with the ClaimCheck, and when
+// the server rejects the put. Blobs of jobs deleted otherwise, such as
+// by a Conn without the ClaimCheck, are left in Store. The Store is
+// passed the context of the put, reserve or peek it serves.
+//
+// A ClaimCheck usually comes last among the Transformers of a Conn, so
+// that the bodies it stores are compressed or encrypted by the others.
+type ClaimCheck struct {
+	Store BlobStore
+
+	// Threshold is the size of the largest body put as it is. If it is
+	// zero, DefaultClaimCheckThreshold is used.
+	Threshold int
+}
+
+// DefaultClaimCheckThreshold is the Threshold of a ClaimCheck whose
+// Threshold is zero. It leaves room below the default max-job-size of
+// beanstalkd, 65535 bytes.
+const DefaultClaimCheckThreshold = 60000
+
+// Encode stores body in Store if it is over the threshold, and returns
+// a reference to it.
+func (cc *ClaimCheck) Encode(ctx context.Context, tube string, body []byte) ([]byte, error) {
+	threshold := cc.Threshold
+	if threshold == 0 {
+		threshold = DefaultClaimCheckThreshold
+	}
+	if len(body) <= threshold {
+		return body, nil
+	}
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return nil, err
+	}
+	key := hex.EncodeToString(b[:])
+	if err := cc.Store.Put(ctx, key, body); err != nil {
+		return nil, err
+	}
+	return append(append([]byte(nil), claimMagic...), key...), nil
+}
+
+// Decode fetches the body that body refers to from Store, if it is a
+// reference.
+func (cc *ClaimCheck) Decode(ctx context.Context, body []byte) ([]byte, error) {
+	key, ok := claimKey(body)
+	if !ok {
+		return body, nil
+	}
+	return cc.Store.Get(ctx, key)
+}
+
+func claimKey(body []byte) (string, bool) {
+	if len(body) <= len(claimMagic) || !bytes.HasPrefix(body, claimMagic) {
+		return "", false
+	}
+	return string(body[len(claimMagic):]), true
+}
+
+// A claim records a blob that holds the body of a reserved job.
+type claim struct {
+	store BlobStore
+	key   string
+}
+
+// keepClaims records the blobs of the job with the given id, reserved
+// by c, for deleteClaims. They are forgotten by settle once the job is
+// no longer reserved by c.
+func (c *Conn) keepClaims(id uint64, claims []claim) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.claims == nil {
+		c.claims = make(map[uint64][]claim)
+	}
+	c.claims[id] = claims
+}
+
+// dropClaims deletes the blobs stored by encodeJob for a job that was
+// not put after all. They are deleted even if ctx is done, as when it
+// is why the put failed.
+func dropClaims(ctx context.Context, claims []claim) {
+	if claims != nil {
+		deleteClaims(context.WithoutCancel(ctx), claims)
+	}
+}
+
+// deleteClaims removes the given blobs of a job that has been deleted.
+func deleteClaims(ctx context.Context, claims []claim) error {
+	for _, cl := range claims {
+		if err := cl.store.Delete(ctx, cl.key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// A FileStore is a BlobStore that keeps each blob in a file in Dir,
+// which must exist. A Dir shared by several hosts, such as over NFS,
+// lets jobs be reserved on another host than the one that put them.
+type FileStore struct {
+	Dir string
+}
+
+func (s FileStore) path(key string) (string, error) {
+	// Keys come from job bodies; keep them from escaping Dir.
+	if key == "" || strings.ContainsAny(key, `/\`) || strings.HasPrefix(key, ".") {
+		return "", fmt.Errorf("beanstalk: invalid blob key %q", key)
+	}
+	return filepath.Join(s.Dir, key), nil
+}
+
+// Put writes data to the file for key. The file appears whole or not
+// at all.
+func (s FileStore) Put(ctx context.Context, key string, data []byte) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(s.Dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// Get reads the file for key.
+func (s FileStore) Get(ctx context.Context, key string) ([]byte, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(path)
+}
+
+// Delete removes the file for key.
+func (s FileStore) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err = os.Remove(path); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
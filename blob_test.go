@@ -0,0 +1,299 @@
+package beanstalk
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+func blobCount(t *testing.T, dir string) int {
+	t.Helper()
+	ents, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(ents)
+}
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+	s := FileStore{t.TempDir()}
+	if err := s.Put(ctx, "k", []byte("data")); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := s.Get(ctx, "k"); err != nil || string(b) != "data" {
+		t.Fatal("got", b, err)
+	}
+	if err := s.Delete(ctx, "k"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete(ctx, "k"); err != nil {
+		t.Fatal("expected deleting a missing blob to succeed, got", err)
+	}
+	if blobCount(t, s.Dir) != 0 {
+		t.Fatal("expected no files left")
+	}
+	for _, key := range []string{"", "../x", "a/b", `a\b`, ".hidden"} {
+		if _, err := s.Get(ctx, key); err == nil {
+			t.Fatalf("expected key %q to be rejected", key)
+		}
+	}
+}
+
+func TestClaimCheck(t *testing.T) {
+	s := newMockServer()
+	c := s.Conn()
+	defer c.Close()
+	dir := t.TempDir()
+	c.SetTransformers(&ClaimCheck{Store: FileStore{dir}, Threshold: 10})
+	big := bytes.Repeat([]byte("x"), 100)
+
+	id, err := c.Put(big, 0, 0, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored := s.job(id).body; len(stored) >= len(big) || !bytes.HasPrefix(stored, claimMagic) {
+		t.Fatalf("expected reference, got %q", stored)
+	}
+	small, _ := c.Put([]byte("small"), 0, 0, time.Minute)
+	if string(s.job(small).body) != "small" {
+		t.Fatal("expected small body as is")
+	}
+	if blobCount(t, dir) != 1 {
+		t.Fatal("expected one blob")
+	}
+
+	// Releasing the job keeps the blob; deleting it removes it.
+	j, err := c.NextJob(0)
+	if err != nil || j.Id != id || !bytes.Equal(j.Body, big) {
+		t.Fatal("expected big job back, got", j, err)
+	}
+	if err = j.Release(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if blobCount(t, dir) != 1 {
+		t.Fatal("expected blob to survive release")
+	}
+	if j, err = c.NextJob(0); err != nil || j.Id != id {
+		t.Fatal("expected big job back, got", j, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err = c.DeleteContext(ctx, id); err == nil {
+		t.Fatal("expected error")
+	}
+	if err = j.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if blobCount(t, dir) != 0 {
+		t.Fatal("expected blob to be deleted along with the job")
+	}
+}
+
+func TestClaimCheckDeleteMany(t *testing.T) {
+	s := newMockServer()
+	c := s.Conn()
+	defer c.Close()
+	dir := t.TempDir()
+	c.SetTransformers(&ClaimCheck{Store: FileStore{dir}, Threshold: 1})
+	var ids []uint64
+	for i := 0; i < 3; i++ {
+		c.Put([]byte("body"), 0, 0, time.Minute)
+		id, _, err := c.Reserve(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	if n, err := c.DeleteMany(ids); err != nil || n != 3 {
+		t.Fatal("got", n, err)
+	}
+	if blobCount(t, dir) != 0 {
+		t.Fatal("expected blobs to be deleted")
+	}
+}
+
+func TestClaimCheckMissingBlob(t *testing.T) {
+	s := newMockServer()
+	c := s.Conn()
+	defer c.Close()
+	c.SetTransformers(&ClaimCheck{Store: FileStore{t.TempDir()}})
+	id := s.put("default", append(append([]byte(nil), claimMagic...), "gone"...), 0, 0, 60)
+	if _, _, err := c.Reserve(0); err == nil {
+		t.Fatal("expected error for missing blob")
+	}
+	if s.job(id).state != "buried" {
+		t.Fatal("expected job to be buried")
+	}
+}
+
+// ctxStore is a BlobStore that fails unless it is passed a context
+// holding ctxKey.
+type ctxStore struct{ FileStore }
+
+type ctxKey struct{}
+
+func (s ctxStore) check(ctx context.Context) error {
+	if ctx.Value(ctxKey{}) == nil {
+		return errors.New("context not passed through")
+	}
+	return nil
+}
+
+func (s ctxStore) Put(ctx context.Context, key string, data []byte) error {
+	if err := s.check(ctx); err != nil {
+		return err
+	}
+	return s.FileStore.Put(ctx, key, data)
+}
+
+func (s ctxStore) Get(ctx context.Context, key string) ([]byte, error) {
+	if err := s.check(ctx); err != nil {
+		return nil, err
+	}
+	return s.FileStore.Get(ctx, key)
+}
+
+func TestClaimCheckContext(t *testing.T) {
+	s := newMockServer()
+	c := s.Conn()
+	defer c.Close()
+	c.SetTransformers(&ClaimCheck{Store: ctxStore{FileStore{t.TempDir()}}, Threshold: 1})
+	ctx := context.WithValue(context.Background(), ctxKey{}, true)
+	tube := &Tube{c, "default"}
+	id, err := tube.PutContext(ctx, []byte("body"), 0, 0, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.PeekContext(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.Peek(id); err == nil {
+		t.Fatal("expected the context of Peek to reach the store")
+	}
+}
+
+func TestClaimCheckStoreFailure(t *testing.T) {
+	s := newMockServer()
+	c := s.Conn()
+	defer c.Close()
+	c.SetTransformers(&ClaimCheck{Store: ctxStore{FileStore{t.TempDir()}}, Threshold: 1})
+	ctx := context.WithValue(context.Background(), ctxKey{}, true)
+	id, err := (&Tube{c, "default"}).PutContext(ctx, []byte("body"), 3, 0, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = c.Reserve(0)
+	var de *DecodeError
+	if !errors.As(err, &de) || !de.Released || de.Buried {
+		t.Fatal("expected the job to be released, got", err)
+	}
+	if j := s.job(id); j.state != "ready" || j.pri != 3 {
+		t.Fatalf("expected the job to be ready again, got %+v", j)
+	}
+	if _, body, err := c.ReserveContext(ctx, 0); err != nil || string(body) != "body" {
+		t.Fatal("got", body, err)
+	}
+}
+
+func TestClaimCheckRejectedPut(t *testing.T) {
+	s := newMockServer()
+	c := s.Conn()
+	defer c.Close()
+	dir := t.TempDir()
+	c.SetTransformers(&ClaimCheck{Store: FileStore{dir}, Threshold: 1})
+	s.mu.Lock()
+	s.draining = true
+	s.mu.Unlock()
+	if _, err := c.Put([]byte("body"), 0, 0, time.Minute); !errors.Is(err, ErrDraining) {
+		t.Fatal("expected ErrDraining, got", err)
+	}
+	res, err := c.PutBatch([]PutRequest{{Body: []byte("a")}, {Body: []byte("b")}})
+	if err != nil || len(res) != 2 || !errors.Is(res[1].Err, ErrDraining) {
+		t.Fatal("got", res, err)
+	}
+	if n := blobCount(t, dir); n != 0 {
+		t.Fatal("expected the blobs of rejected puts to be deleted, got", n)
+	}
+}
+
+func TestClaimCheckFailedBatch(t *testing.T) {
+	cli, srv := net.Pipe()
+	defer srv.Close() // never read
+	c := NewConn(cli)
+	c.wTimeout = 20 * time.Millisecond
+	dir := t.TempDir()
+	c.SetTransformers(&ClaimCheck{Store: FileStore{dir}, Threshold: 1})
+	jobs := make([]PutRequest, 1000)
+	for i := range jobs {
+		jobs[i].Body = []byte("body")
+	}
+	if _, err := c.PutBatch(jobs); err == nil {
+		t.Fatal("expected error")
+	}
+	n := blobCount(t, dir)
+	if n == 0 || n >= len(jobs) {
+		t.Fatal("expected the blobs of the jobs never written to be deleted, got", n)
+	}
+
+	c.Close()
+	if _, err := c.PutBatch(jobs); err == nil {
+		t.Fatal("expected error")
+	}
+	if m := blobCount(t, dir); m != n {
+		t.Fatal("expected the blobs of a batch never sent to be deleted, got", m-n)
+	}
+}
+
+func TestClaimCheckPurge(t *testing.T) {
+	s := newMockServer()
+	c := s.Conn()
+	defer c.Close()
+	dir := t.TempDir()
+	c.SetTransformers(&ClaimCheck{Store: FileStore{dir}, Threshold: 1}, &Signer{Keys: map[string][]byte{"k1": testKey1}, KeyID: "k1"})
+	for i := 0; i < 3; i++ {
+		if _, err := c.Put([]byte("body"), 0, 0, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n, err := c.Tube.Purge(); err != nil || n != 3 {
+		t.Fatal("got", n, err)
+	}
+	if n := blobCount(t, dir); n != 0 {
+		t.Fatal("expected the blobs of purged jobs to be deleted, got", n)
+	}
+}
+
+func TestClaimCheckCopyTo(t *testing.T) {
+	s := newMockServer()
+	c := s.Conn()
+	defer c.Close()
+	dir := t.TempDir()
+	c.SetTransformers(&ClaimCheck{Store: FileStore{dir}, Threshold: 1})
+	id, err := (&Tube{c, "a"}).PutHeader([]byte("body"), Header{"k": "v"}, 0, 0, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	moved, err := (&Tube{c, "a"}).CopyTo(&Tube{c, "b"}, MoveOptions{State: "ready"})
+	if err != nil || len(moved) != 1 {
+		t.Fatal("got", moved, err)
+	}
+	if n := blobCount(t, dir); n != 2 {
+		t.Fatal("expected the copy to have a blob of its own, got", n)
+	}
+
+	if _, err = c.ReserveJob(id); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Delete(id); err != nil {
+		t.Fatal(err)
+	}
+	j, err := NewTubeSet(c, "b").NextJob(0)
+	if err != nil || j.Id != moved[0].NewId || string(j.Body) != "body" || j.Header["k"] != "v" {
+		t.Fatal("expected the copy intact, got", j, err)
+	}
+}
@@ -0,0 +1,156 @@
+package beanstalk
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// kickAllBound is the bound of each kick command sent by Tube.KickAll,
+// which keeps the server from stalling on one huge kick.
+const kickAllBound = 10000
+
+// A BulkError records the jobs for which the individual commands of a
+// bulk operation failed, while the rest succeeded.
+type BulkError struct {
+	Op   string
+	Errs map[uint64]error // by job id
+}
+
+func (e *BulkError) Error() string {
+	ids := make([]uint64, 0, len(e.Errs))
+	for id := range e.Errs {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return fmt.Sprintf("%s: %d jobs failed, first job %d: %v", e.Op, len(ids), ids[0], e.Errs[ids[0]])
+}
+
+func (e *BulkError) add(op string, id uint64, err error) *BulkError {
+	if e == nil {
+		e = &BulkError{Op: op, Errs: make(map[uint64]error)}
+	}
+	e.Errs[id] = err
+	return e
+}
+
+// DeleteMany deletes the jobs with the given ids, sending all the
+// delete commands in one go, and returns the number deleted. If some of
+// the deletes failed, the error is a *BulkError recording why, by job
+// id; other errors mean the connection failed part way through.
+func (c *Conn) DeleteMany(ids []uint64) (n int, err error) {
+	return c.DeleteManyContext(context.Background(), ids)
+}
+
+// DeleteManyContext is like DeleteMany, but takes a context.
+func (c *Conn) DeleteManyContext(ctx context.Context, ids []uint64) (n int, err error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	settled := make([]func(ok bool) []claim, len(ids))
+	for i, id := range ids {
+		settled[i] = c.settle(id)
+	}
+	var bulk *BulkError
+	read, err := c.pipelineBatch(ctx, nil, "delete", len(ids), func(i int) {
+		c.printLine("delete", "", ids[i])
+	}, func(i int, header []byte) {
+		if err := c.scan(header, "DELETED", nil); err != nil {
+			settled[i](false)
+			bulk = bulk.add("delete", ids[i], ConnError{c, "delete", err})
+			return
+		}
+		n++
+		if err := deleteClaims(ctx, settled[i](true)); err != nil {
+			bulk = bulk.add("delete", ids[i], err)
+		}
+	})
+	for _, done := range settled[read:] {
+		done(false)
+	}
+	if err == nil && bulk != nil {
+		err = bulk
+	}
+	return n, err
+}
+
+// Purge deletes all the jobs in t in the given states, which may be
+// "ready", "delayed" and "buried", or in all three if none are given,
+// and returns the number deleted. Each delete is sent together with
+// the peek for the next job, so each job costs one round trip. Jobs
+// that are reserved are left alone, and the blobs of those that are
+// deleted are deleted too if a ClaimCheck of t.Conn stored them. If
+// some of the deletes failed, the error is a *BulkError recording why,
+// by job id.
+func (t *Tube) Purge(states ...string) (n int, err error) {
+	return t.PurgeContext(context.Background(), states...)
+}
+
+// PurgeContext is like Purge, but takes a context.
+func (t *Tube) PurgeContext(ctx context.Context, states ...string) (n int, err error) {
+	if len(states) == 0 {
+		states = []string{"ready", "delayed", "buried"}
+	}
+	var bulk *BulkError
+	for _, state := range states {
+		peek := t.rawPeek(state)
+		if peek == nil {
+			return n, fmt.Errorf("beanstalk: cannot purge jobs in state %q", state)
+		}
+		var (
+			del    *Future
+			delId  uint64
+			claims []claim
+		)
+		for {
+			id, body, err := peek(ctx)
+			// Responses come in order, so the delete sent ahead of the
+			// peek is done by now.
+			if del != nil {
+				if derr := del.Err(); derr == nil {
+					n++
+					if cerr := deleteClaims(ctx, claims); cerr != nil {
+						bulk = bulk.add("delete", delId, cerr)
+					}
+				} else if isIOError(derr) {
+					return n, derr
+				} else {
+					bulk = bulk.add("delete", delId, derr)
+				}
+				del = nil
+			}
+			if e, ok := err.(ConnError); ok && e.Err == ErrNotFound {
+				break
+			} else if err != nil {
+				return n, err
+			}
+			if bulk != nil && bulk.Errs[id] != nil {
+				break // the job cannot be deleted; don't spin on it
+			}
+			del, delId = t.Conn.DeleteAsync(id), id
+			claims = t.Conn.claimsOf(ctx, body)
+		}
+	}
+	if bulk != nil {
+		return n, bulk
+	}
+	return n, nil
+}
+
+// KickAll kicks all the buried jobs in t into the ready queue, and
+// then all the delayed jobs, and returns the number kicked. It sends
+// kick commands until one kicks nothing.
+func (t *Tube) KickAll() (n uint64, err error) {
+	return t.KickAllContext(context.Background())
+}
+
+// KickAllContext is like KickAll, but takes a context.
+func (t *Tube) KickAllContext(ctx context.Context) (n uint64, err error) {
+	for {
+		k, err := t.KickContext(ctx, kickAllBound)
+		n += k
+		if err != nil || k == 0 {
+			return n, err
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package beanstalk
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDeleteMany(t *testing.T) {
+	c := NewConn(mock(
+		"delete 1\r\ndelete 2\r\ndelete 3\r\n",
+		"DELETED\r\nNOT_FOUND\r\nDELETED\r\n",
+	))
+	n, err := c.DeleteMany([]uint64{1, 2, 3})
+	if n != 2 {
+		t.Fatal("expected 2 deleted, got", n)
+	}
+	var bulk *BulkError
+	if !errors.As(err, &bulk) || len(bulk.Errs) != 1 || !errors.Is(bulk.Errs[2], ErrNotFound) {
+		t.Fatal("expected BulkError for job 2, got", err)
+	}
+}
+
+func TestDeleteManyBrokenConn(t *testing.T) {
+	c := NewConn(mock("delete 1\r\ndelete 2\r\n", "DELETED\r\n"))
+	n, err := c.DeleteMany([]uint64{1, 2})
+	if n != 1 || err == nil {
+		t.Fatal("expected 1 deleted and an error, got", n, err)
+	}
+	if _, ok := err.(*BulkError); ok {
+		t.Fatal("expected connection error, got", err)
+	}
+}
+
+func TestPurge(t *testing.T) {
+	s := newMockServer()
+	c := s.Conn()
+	defer c.Close()
+	for i := 0; i < 3; i++ {
+		s.put("a", []byte("ready"), 0, 0, 60)
+		s.put("a", []byte("delayed"), 0, 10, 60)
+		s.put("b", []byte("other"), 0, 0, 60)
+	}
+	for i := 0; i < 2; i++ {
+		id, _, err := NewTubeSet(c, "a").Reserve(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = c.Bury(id, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	reserved, _, err := NewTubeSet(c, "a").Reserve(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := &Tube{c, "a"}
+	n, err := a.Purge("buried")
+	if err != nil || n != 2 {
+		t.Fatal("got", n, err)
+	}
+	if n, err = a.Purge(); err != nil || n != 3 {
+		t.Fatal("got", n, err)
+	}
+	if s.job(reserved) == nil {
+		t.Fatal("expected reserved job to be left alone")
+	}
+	if s.count("a", "ready")+s.count("a", "delayed")+s.count("a", "buried") != 0 {
+		t.Fatal("expected tube a to be empty")
+	}
+	if s.count("b", "ready") != 3 {
+		t.Fatal("expected tube b to be left alone")
+	}
+	if _, err = a.Purge("reserved"); err == nil {
+		t.Fatal("expected error for bad state")
+	}
+}
+
+func TestKickAll(t *testing.T) {
+	s := newMockServer()
+	c := s.Conn()
+	defer c.Close()
+	for i := 0; i < 2; i++ {
+		s.put("default", []byte("delayed"), 0, 10, 60)
+	}
+	for i := 0; i < 3; i++ {
+		s.put("default", []byte("x"), 0, 0, 60)
+		id, _, err := c.Reserve(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = c.Bury(id, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, err := c.KickAll()
+	if err != nil || n != 5 {
+		t.Fatal("got", n, err)
+	}
+	if s.count("default", "ready") != 5 {
+		t.Fatal("expected all jobs ready")
+	}
+}
@@ -0,0 +1,119 @@
+package beanstalk
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// A Codec encodes values to job bodies and decodes them back.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// Codecs provided by the package.
+var (
+	JSON Codec = jsonCodec{}
+	Gob  Codec = gobCodec{}
+)
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+type gobCodec struct{}
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+	var b bytes.Buffer
+	if err := gob.NewEncoder(&b).Encode(v); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+var codecs struct {
+	sync.RWMutex
+	m map[string]Codec
+}
+
+// RegisterCodec makes c the Codec for the values in tube, for all the
+// Conns in the process. Producers and consumers of a tube should
+// register the same Codec. If c is nil, the registration is removed.
+func RegisterCodec(tube string, c Codec) {
+	codecs.Lock()
+	defer codecs.Unlock()
+	if c == nil {
+		delete(codecs.m, tube)
+		return
+	}
+	if codecs.m == nil {
+		codecs.m = make(map[string]Codec)
+	}
+	codecs.m[tube] = c
+}
+
+// CodecFor returns the Codec registered for tube, or JSON if there is
+// none.
+func CodecFor(tube string) Codec {
+	codecs.RLock()
+	c := codecs.m[tube]
+	codecs.RUnlock()
+	if c == nil {
+		return JSON
+	}
+	return c
+}
+
+// Decode decodes the body of j into v with the Codec for j's tube.
+func (j *Job) Decode(v interface{}) error {
+	return CodecFor(j.Tube).Unmarshal(j.Body, v)
+}
+
+// PutValue encodes v with the Codec for t and puts it as the body of a
+// new job, as by Tube.Put.
+func PutValue[T any](t *Tube, v T, pri uint32, delay, ttr time.Duration) (uint64, error) {
+	return PutValueContext(context.Background(), t, v, pri, delay, ttr)
+}
+
+// PutValueContext is like PutValue, but takes a context.
+func PutValueContext[T any](ctx context.Context, t *Tube, v T, pri uint32, delay, ttr time.Duration) (uint64, error) {
+	body, err := CodecFor(t.Name).Marshal(v)
+	if err != nil {
+		return 0, err
+	}
+	return t.PutContext(ctx, body, pri, delay, ttr)
+}
+
+// ReserveValue reserves a job from ts, as by TubeSet.NextJob, and
+// decodes its body with the Codec for its tube. If decoding fails, the
+// job stays reserved and its id is returned with the error, so that
+// the caller can bury or delete it.
+func ReserveValue[T any](ts *TubeSet, timeout time.Duration) (id uint64, v T, err error) {
+	return ReserveValueContext[T](context.Background(), ts, timeout)
+}
+
+// ReserveValueContext is like ReserveValue, but takes a context.
+func ReserveValueContext[T any](ctx context.Context, ts *TubeSet, timeout time.Duration) (id uint64, v T, err error) {
+	j, err := ts.NextJobContext(ctx, timeout)
+	if j == nil {
+		return 0, v, err
+	}
+	if err == nil {
+		err = j.Decode(&v)
+	}
+	return j.Id, v, err
+}
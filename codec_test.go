@@ -0,0 +1,78 @@
+package beanstalk
+
+import (
+	"testing"
+	"time"
+)
+
+type testValue struct {
+	Name  string
+	Count int
+}
+
+func TestPutReserveValue(t *testing.T) {
+	s := newMockServer()
+	c := s.Conn()
+	defer c.Close()
+	RegisterCodec("gob-tube", Gob)
+	defer RegisterCodec("gob-tube", nil)
+
+	for _, tube := range []string{"json-tube", "gob-tube"} {
+		want := testValue{"x", 3}
+		id, err := PutValue(&Tube{c, tube}, want, 0, 0, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gotId, got, err := ReserveValue[testValue](NewTubeSet(c, tube), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if gotId != id || got != want {
+			t.Fatalf("%s: got %d %+v", tube, gotId, got)
+		}
+	}
+}
+
+func TestCodecWireFormat(t *testing.T) {
+	s := newMockServer()
+	c := s.Conn()
+	defer c.Close()
+	id, err := PutValue(&Tube{c, "a"}, testValue{"x", 3}, 0, 0, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body := string(s.job(id).body); body != `{"Name":"x","Count":3}` {
+		t.Fatal("expected JSON by default, got", body)
+	}
+}
+
+func TestReserveValueDecodeError(t *testing.T) {
+	s := newMockServer()
+	c := s.Conn()
+	defer c.Close()
+	want := s.put("a", []byte("not json"), 0, 0, 60)
+
+	id, _, err := ReserveValue[testValue](NewTubeSet(c, "a"), 0)
+	if err == nil || id != want {
+		t.Fatal("expected decoding error with id, got", id, err)
+	}
+	if s.job(id).state != "reserved" {
+		t.Fatal("expected job to stay reserved")
+	}
+}
+
+func TestJobDecode(t *testing.T) {
+	RegisterCodec("gob-tube", Gob)
+	defer RegisterCodec("gob-tube", nil)
+	body, err := Gob.Marshal(testValue{"y", 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v testValue
+	if err = (&Job{Body: body, Tube: "gob-tube"}).Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	if v != (testValue{"y", 1}) {
+		t.Fatalf("got %+v", v)
+	}
+}
@@ -1,9 +1,17 @@
 package beanstalk
 
 import (
+	"bufio"
+	"context"
 	"fmt"
 	"io"
+	"net"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"testing"
+	"time"
 )
 
 type mockError struct {
@@ -63,3 +71,417 @@ func (m mockIO) Close() error {
 	m.send.Read(b)
 	return mockError{b, nil}
 }
+
+// mockServer is a tiny in-memory beanstalkd. Unlike mock, it does not
+// expect a fixed transcript, so it can serve commands issued by many
+// goroutines in whatever order they reach it. Delays and TTRs are
+// recorded but never elapse.
+type mockServer struct {
+	mu    sync.Mutex
+	next  uint64
+	jobs  map[uint64]*mockJob
+	conns []io.Closer
+	dials int
+
+	draining  bool // refuse puts with DRAINING
+	statsFail bool // fail stats-job with INTERNAL_ERROR
+}
+
+type mockJob struct {
+	id       uint64
+	tube     string
+	body     []byte
+	pri      uint64
+	delay    uint64
+	ttr      uint64
+	state    string
+	owner    io.ReadWriteCloser
+	reserves uint64
+	releases uint64
+	buries   uint64
+	kicks    uint64
+	touches  uint64
+}
+
+func newMockServer() *mockServer {
+	return &mockServer{jobs: make(map[uint64]*mockJob)}
+}
+
+// Conn returns a new Conn talking to s over an in-memory pipe.
+func (s *mockServer) Conn() *Conn {
+	rwc, _ := s.DialRaw(context.Background())
+	return NewConn(rwc)
+}
+
+// DialRaw returns the client end of a new in-memory pipe to s.
+func (s *mockServer) DialRaw(ctx context.Context) (io.ReadWriteCloser, error) {
+	cli, srv := net.Pipe()
+	s.mu.Lock()
+	s.conns = append(s.conns, srv)
+	s.dials++
+	s.mu.Unlock()
+	go s.serve(srv)
+	return cli, nil
+}
+
+// Dial is like Conn, but has the signature of Pool.Dial.
+func (s *mockServer) Dial(ctx context.Context) (*Conn, error) {
+	return s.Conn(), nil
+}
+
+// disconnect drops all connections to s.
+func (s *mockServer) disconnect() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.conns {
+		c.Close()
+	}
+	s.conns = nil
+}
+
+// job returns a copy of the job with the given id, or nil.
+func (s *mockServer) job(id uint64) *mockJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j := s.jobs[id]
+	if j == nil {
+		return nil
+	}
+	c := *j
+	return &c
+}
+
+// count returns the number of jobs in tube in the given state.
+func (s *mockServer) count(tube, state string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, j := range s.jobs {
+		if j.tube == tube && j.state == state {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *mockServer) serve(rw io.ReadWriteCloser) {
+	defer func() {
+		rw.Close()
+		s.mu.Lock()
+		for _, j := range s.jobs {
+			if j.owner == rw {
+				j.state, j.owner = "ready", nil
+			}
+		}
+		s.mu.Unlock()
+	}()
+	r := bufio.NewReader(rw)
+	w := bufio.NewWriter(rw)
+	used := "default"
+	watched := map[string]bool{"default": true}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		f := strings.Fields(line)
+		if len(f) == 0 {
+			fmt.Fprint(w, "BAD_FORMAT\r\n")
+			w.Flush()
+			continue
+		}
+		arg := func(i int) uint64 {
+			n, _ := strconv.ParseUint(f[i], 10, 64)
+			return n
+		}
+		switch f[0] {
+		case "use":
+			used = f[1]
+			fmt.Fprintf(w, "USING %s\r\n", used)
+		case "list-tube-used":
+			fmt.Fprintf(w, "USING %s\r\n", used)
+		case "list-tubes-watched":
+			writeList(w, sortedKeys(watched))
+		case "list-tubes":
+			s.mu.Lock()
+			tubes := map[string]bool{"default": true}
+			for _, j := range s.jobs {
+				tubes[j.tube] = true
+			}
+			s.mu.Unlock()
+			writeList(w, sortedKeys(tubes))
+		case "watch":
+			watched[f[1]] = true
+			fmt.Fprintf(w, "WATCHING %d\r\n", len(watched))
+		case "ignore":
+			if len(watched) == 1 && watched[f[1]] {
+				fmt.Fprint(w, "NOT_IGNORED\r\n")
+				break
+			}
+			delete(watched, f[1])
+			fmt.Fprintf(w, "WATCHING %d\r\n", len(watched))
+		case "put":
+			n, _ := strconv.Atoi(f[4])
+			body := make([]byte, n+2)
+			if _, err := io.ReadFull(r, body); err != nil {
+				return
+			}
+			s.mu.Lock()
+			draining := s.draining
+			s.mu.Unlock()
+			if draining {
+				fmt.Fprint(w, "DRAINING\r\n")
+				break
+			}
+			j := s.put(used, body[:n], arg(1), arg(2), arg(3))
+			fmt.Fprintf(w, "INSERTED %d\r\n", j)
+		case "peek":
+			s.found(w, "FOUND", s.job(arg(1)))
+		case "peek-ready", "peek-delayed", "peek-buried":
+			s.found(w, "FOUND", s.first(map[string]bool{used: true}, f[0][len("peek-"):]))
+		case "reserve-with-timeout", "reserve":
+			j := s.reserve(watched, 0, rw)
+			if j == nil {
+				if f[0] == "reserve" || arg(1) > 0 {
+					time.Sleep(10 * time.Millisecond) // don't let pollers spin
+				}
+				fmt.Fprint(w, "TIMED_OUT\r\n")
+				break
+			}
+			s.found(w, "RESERVED", j)
+		case "reserve-job":
+			s.found(w, "RESERVED", s.reserve(nil, arg(1), rw))
+		case "delete":
+			s.update(w, arg(1), "DELETED", func(j *mockJob) bool {
+				if j.state == "reserved" && j.owner != rw {
+					return false
+				}
+				delete(s.jobs, j.id)
+				return true
+			})
+		case "release":
+			s.update(w, arg(1), "RELEASED", func(j *mockJob) bool {
+				if j.state != "reserved" || j.owner != rw {
+					return false
+				}
+				j.pri, j.delay, j.owner = arg(2), arg(3), nil
+				j.state = "ready"
+				if j.delay > 0 {
+					j.state = "delayed"
+				}
+				j.releases++
+				return true
+			})
+		case "bury":
+			s.update(w, arg(1), "BURIED", func(j *mockJob) bool {
+				if j.state != "reserved" || j.owner != rw {
+					return false
+				}
+				j.pri, j.state, j.owner = arg(2), "buried", nil
+				j.buries++
+				return true
+			})
+		case "touch":
+			s.update(w, arg(1), "TOUCHED", func(j *mockJob) bool {
+				if j.state != "reserved" || j.owner != rw {
+					return false
+				}
+				j.touches++
+				return true
+			})
+		case "kick-job":
+			s.update(w, arg(1), "KICKED", func(j *mockJob) bool {
+				if j.state != "buried" && j.state != "delayed" {
+					return false
+				}
+				j.state = "ready"
+				j.kicks++
+				return true
+			})
+		case "kick":
+			fmt.Fprintf(w, "KICKED %d\r\n", s.kick(used, int(arg(1))))
+		case "stats-tube":
+			n := map[string]int{}
+			s.mu.Lock()
+			for _, j := range s.jobs {
+				if j.tube == f[1] {
+					n[j.state]++
+				}
+			}
+			s.mu.Unlock()
+			y := fmt.Sprintf("---\nname: %s\ncurrent-jobs-urgent: 0\ncurrent-jobs-ready: %d\n"+
+				"current-jobs-reserved: %d\ncurrent-jobs-delayed: %d\ncurrent-jobs-buried: %d\n",
+				f[1], n["ready"], n["reserved"], n["delayed"], n["buried"])
+			fmt.Fprintf(w, "OK %d\r\n%s\r\n", len(y), y)
+		case "stats":
+			s.mu.Lock()
+			y := fmt.Sprintf("---\ntotal-jobs: %d\n", s.next)
+			s.mu.Unlock()
+			fmt.Fprintf(w, "OK %d\r\n%s\r\n", len(y), y)
+		case "stats-job":
+			s.mu.Lock()
+			fail := s.statsFail
+			s.mu.Unlock()
+			if fail {
+				fmt.Fprint(w, "INTERNAL_ERROR\r\n")
+				break
+			}
+			j := s.job(arg(1))
+			if j == nil {
+				fmt.Fprint(w, "NOT_FOUND\r\n")
+				break
+			}
+			left := j.ttr
+			if j.state == "delayed" {
+				left = j.delay
+			}
+			y := fmt.Sprintf("---\nid: %d\ntube: %s\nstate: %s\npri: %d\n"+
+				"age: 0\ndelay: %d\nttr: %d\ntime-left: %d\nfile: 0\n"+
+				"reserves: %d\ntimeouts: 0\nreleases: %d\nburies: %d\nkicks: %d\n",
+				j.id, j.tube, j.state, j.pri, j.delay, j.ttr, left,
+				j.reserves, j.releases, j.buries, j.kicks)
+			fmt.Fprintf(w, "OK %d\r\n%s\r\n", len(y), y)
+		default:
+			fmt.Fprint(w, "UNKNOWN_COMMAND\r\n")
+		}
+		if err := w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func writeList(w io.Writer, l []string) {
+	var b strings.Builder
+	b.WriteString("---\n")
+	for _, s := range l {
+		fmt.Fprintf(&b, "- %s\n", s)
+	}
+	fmt.Fprintf(w, "OK %d\r\n%s\r\n", b.Len(), b.String())
+}
+
+func (s *mockServer) found(w io.Writer, res string, j *mockJob) {
+	if j == nil {
+		fmt.Fprint(w, "NOT_FOUND\r\n")
+		return
+	}
+	fmt.Fprintf(w, "%s %d %d\r\n%s\r\n", res, j.id, len(j.body), j.body)
+}
+
+// update applies f to the job with the given id and replies with res,
+// or with NOT_FOUND if there is no such job or f returns false.
+func (s *mockServer) update(w io.Writer, id uint64, res string, f func(*mockJob) bool) {
+	s.mu.Lock()
+	j := s.jobs[id]
+	ok := j != nil && f(j)
+	s.mu.Unlock()
+	if !ok {
+		res = "NOT_FOUND"
+	}
+	fmt.Fprintf(w, "%s\r\n", res)
+}
+
+func (s *mockServer) put(tube string, body []byte, pri, delay, ttr uint64) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.next++
+	j := &mockJob{
+		id:    s.next,
+		tube:  tube,
+		body:  append([]byte(nil), body...),
+		pri:   pri,
+		delay: delay,
+		ttr:   ttr,
+		state: "ready",
+	}
+	if delay > 0 {
+		j.state = "delayed"
+	}
+	s.jobs[j.id] = j
+	return j.id
+}
+
+// first returns the oldest job in one of tubes in the given state.
+// s.mu must not be held.
+func (s *mockServer) first(tubes map[string]bool, state string) *mockJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j := s.firstLocked(tubes, state)
+	if j == nil {
+		return nil
+	}
+	c := *j
+	return &c
+}
+
+func (s *mockServer) firstLocked(tubes map[string]bool, state string) *mockJob {
+	var first *mockJob
+	for _, j := range s.jobs {
+		if j.state == state && tubes[j.tube] && (first == nil || j.id < first.id) {
+			first = j
+		}
+	}
+	return first
+}
+
+// reserve reserves the oldest ready job in one of tubes for owner, or
+// the job with the given id if tubes is nil.
+func (s *mockServer) reserve(tubes map[string]bool, id uint64, owner io.ReadWriteCloser) *mockJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var j *mockJob
+	if tubes == nil {
+		j = s.jobs[id]
+		if j != nil && j.state == "reserved" {
+			j = nil
+		}
+	} else {
+		j = s.firstLocked(tubes, "ready")
+	}
+	if j == nil {
+		return nil
+	}
+	j.state, j.owner = "reserved", owner
+	j.reserves++
+	c := *j
+	return &c
+}
+
+func (s *mockServer) kick(tube string, bound int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tubes := map[string]bool{tube: true}
+	state := "buried"
+	if s.firstLocked(tubes, state) == nil {
+		state = "delayed"
+	}
+	n := 0
+	for ; n < bound; n++ {
+		j := s.firstLocked(tubes, state)
+		if j == nil {
+			break
+		}
+		j.state = "ready"
+		j.kicks++
+	}
+	return n
+}
+
+func sortedKeys(m map[string]bool) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// waitFor polls cond until it holds, failing t if that takes too long.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); !cond(); {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,141 @@
+package beanstalk
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// A CompressionFormat is a format in which a Compressor compresses
+// job bodies.
+type CompressionFormat byte
+
+// Compression formats. Flate is faster; Gzip adds a checksum.
+const (
+	Gzip  CompressionFormat = 'g'
+	Flate CompressionFormat = 'f'
+)
+
+// DefaultCompressMinSize is the size below which a Compressor with a
+// zero MinSize leaves bodies uncompressed.
+const DefaultCompressMinSize = 1024
+
+// DefaultCompressMaxSize is the size of the largest body a Compressor
+// with a zero MaxSize decompresses.
+const DefaultCompressMaxSize = 64 << 20
+
+// ErrBodyTooLarge is recorded by a DecodeError for a job whose body
+// decompresses to more than the MaxSize of the Compressor.
+var ErrBodyTooLarge = errors.New("decompressed body too large")
+
+// A compressed body is the magic, followed by its CompressionFormat and
+// the compressed data.
+var compressMagic = []byte("\x00BJZ")
+
+// A Compressor is a Transformer that compresses job bodies, to fit more
+// into the max-job-size of the server. Bodies smaller than MinSize, or
+// that do not shrink, are put as they are; a prefix tells compressed
+// bodies apart when they are read, so producers with and without a
+// Compressor can share a tube. Decode reads either format, whatever the
+// Format of the Compressor.
+type Compressor struct {
+	Format CompressionFormat // Gzip if zero
+
+	// Level is the compression level, as for compress/flate. If it is
+	// zero, flate.DefaultCompression is used.
+	Level int
+
+	// MinSize is the size of the smallest body to compress. If it is
+	// zero, DefaultCompressMinSize is used.
+	MinSize int
+
+	// MaxSize is the size of the largest body Decode decompresses, so
+	// that a small job cannot expand into all of memory. If it is
+	// zero, DefaultCompressMaxSize is used.
+	MaxSize int
+}
+
+// Encode compresses body, if it is large enough.
+func (z *Compressor) Encode(ctx context.Context, tube string, body []byte) ([]byte, error) {
+	min := z.MinSize
+	if min == 0 {
+		min = DefaultCompressMinSize
+	}
+	if len(body) < min {
+		return body, nil
+	}
+	format := z.Format
+	if format == 0 {
+		format = Gzip
+	}
+	level := z.Level
+	if level == 0 {
+		level = flate.DefaultCompression
+	}
+
+	var b bytes.Buffer
+	b.Write(compressMagic)
+	b.WriteByte(byte(format))
+	var w io.WriteCloser
+	var err error
+	switch format {
+	case Gzip:
+		w, err = gzip.NewWriterLevel(&b, level)
+	case Flate:
+		w, err = flate.NewWriter(&b, level)
+	default:
+		return nil, fmt.Errorf("beanstalk: unknown compression format %q", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(body); err == nil {
+		err = w.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if b.Len() >= len(body) {
+		return body, nil
+	}
+	return b.Bytes(), nil
+}
+
+// Decode decompresses body if it was compressed by a Compressor, and
+// returns it unchanged otherwise.
+func (z *Compressor) Decode(ctx context.Context, body []byte) ([]byte, error) {
+	if len(body) <= len(compressMagic) || !bytes.HasPrefix(body, compressMagic) {
+		return body, nil
+	}
+	src := bytes.NewReader(body[len(compressMagic)+1:])
+	var r io.ReadCloser
+	switch CompressionFormat(body[len(compressMagic)]) {
+	case Gzip:
+		var err error
+		if r, err = gzip.NewReader(src); err != nil {
+			return nil, err
+		}
+	case Flate:
+		r = flate.NewReader(src)
+	default:
+		// Not made by a Compressor.
+		return body, nil
+	}
+	defer r.Close()
+	max := z.MaxSize
+	if max == 0 {
+		max = DefaultCompressMaxSize
+	}
+	b, err := io.ReadAll(io.LimitReader(r, int64(max)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > max {
+		return nil, ErrBodyTooLarge
+	}
+	return b, nil
+}
@@ -0,0 +1,126 @@
+package beanstalk
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompressor(t *testing.T) {
+	s := newMockServer()
+	c := s.Conn()
+	defer c.Close()
+	big := []byte(strings.Repeat(`{"key":"value"},`, 1000))
+
+	for _, format := range []CompressionFormat{0, Gzip, Flate} {
+		c.SetTransformers(&Compressor{Format: format})
+		id, err := c.Put(big, 0, 0, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored := s.job(id).body; len(stored) >= len(big) || !bytes.HasPrefix(stored, compressMagic) {
+			t.Fatalf("format %q: expected compressed body, got %d bytes", format, len(stored))
+		}
+		body, err := c.Peek(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(body, big) {
+			t.Fatalf("format %q: got %d bytes back", format, len(body))
+		}
+		c.Delete(id)
+	}
+}
+
+func TestCompressorSmall(t *testing.T) {
+	s := newMockServer()
+	c := s.Conn()
+	defer c.Close()
+	c.SetTransformers(&Compressor{})
+	id, err := c.Put([]byte("small"), 0, 0, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body := string(s.job(id).body); body != "small" {
+		t.Fatalf("expected small body as is, got %q", body)
+	}
+}
+
+func TestCompressorMixed(t *testing.T) {
+	s := newMockServer()
+	c := s.Conn()
+	defer c.Close()
+	big := bytes.Repeat([]byte("a"), 5000)
+	plain := s.put("default", big, 0, 0, 60)
+	c.SetTransformers(&Compressor{Format: Flate, MinSize: 1})
+	zipped, _ := c.Put(big, 0, 0, time.Minute)
+
+	// A Conn with a different Format reads both.
+	c.SetTransformers(&Compressor{})
+	for _, id := range []uint64{plain, zipped} {
+		if body, err := c.Peek(id); err != nil || !bytes.Equal(body, big) {
+			t.Fatal("expected body back, got", err)
+		}
+	}
+	c.SetTransformers()
+	if body, err := c.Peek(zipped); err != nil || bytes.Equal(body, big) {
+		t.Fatal("expected compressed body without a Compressor, got", err)
+	}
+}
+
+func TestCompressorHeader(t *testing.T) {
+	s := newMockServer()
+	c := s.Conn()
+	defer c.Close()
+	c.SetTransformers(&Compressor{MinSize: 1})
+	big := bytes.Repeat([]byte("a"), 5000)
+	if _, err := c.PutHeader(big, Header{HeaderTraceID: "t"}, 0, 0, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	j, err := c.NextJob(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(j.Body, big) || j.Header[HeaderTraceID] != "t" {
+		t.Fatal("got headers", j.Header)
+	}
+}
+
+func TestCompressorCorrupt(t *testing.T) {
+	s := newMockServer()
+	c := s.Conn()
+	defer c.Close()
+	c.SetTransformers(&Compressor{})
+	id := s.put("default", append(append([]byte(nil), compressMagic...), "gjunk"...), 0, 0, 60)
+	_, err := c.Peek(id)
+	var de *DecodeError
+	if !errors.As(err, &de) || de.Id != id {
+		t.Fatal("expected DecodeError, got", err)
+	}
+}
+
+func TestCompressorMaxSize(t *testing.T) {
+	s := newMockServer()
+	c := s.Conn()
+	defer c.Close()
+	c.SetTransformers(&Compressor{MinSize: 1, MaxSize: 1000})
+	small, _ := c.Put(bytes.Repeat([]byte("x"), 1000), 0, 0, time.Minute)
+	if !bytes.HasPrefix(s.job(small).body, compressMagic) {
+		t.Fatal("expected compressed body")
+	}
+	if _, err := c.Peek(small); err != nil {
+		t.Fatal(err)
+	}
+
+	// Expands past MaxSize.
+	c.SetTransformers(&Compressor{MinSize: 1})
+	big, _ := c.Put(bytes.Repeat([]byte("x"), 1001), 0, 0, time.Minute)
+	c.SetTransformers(&Compressor{MinSize: 1, MaxSize: 1000})
+	_, err := c.Peek(big)
+	var de *DecodeError
+	if !errors.As(err, &de) || de.Id != big || !errors.Is(err, ErrBodyTooLarge) {
+		t.Fatal("expected DecodeError for ErrBodyTooLarge, got", err)
+	}
+}
@@ -0,0 +1,155 @@
+package beanstalk
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"time"
+)
+
+// A Config structures the options used by DialConfig. The zero Config
+// dials a TCP address the same way as Dial.
+type Config struct {
+	// Network is the network to dial, such as "tcp" or "unix". If it
+	// is empty, "tcp" is used. For "unix", addr is the socket path.
+	Network string
+
+	// Dialer dials the connection. If it is nil, a net.Dialer with
+	// DefaultDialTimeout and DefaultKeepAlivePeriod is used.
+	Dialer *net.Dialer
+
+	// DialFunc, if non-nil, dials the connection in place of Dialer,
+	// for example through a SOCKS proxy.
+	DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+	// TLS, if non-nil, makes the Conn speak TLS over the dialed
+	// connection, as needed for a beanstalkd fronted by stunnel. If its
+	// ServerName is empty, the host part of addr is used.
+	TLS *tls.Config
+
+	// ReadTimeout and WriteTimeout, if nonzero, bound the time spent
+	// reading each response and writing each command. Reserve commands
+	// add their own timeout to ReadTimeout, and ReserveBlocking is not
+	// bound by it at all. A Conn whose I/O times out is unusable.
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+
+	// Use and Watch, if set, name the tubes that the default Tube and
+	// TubeSet of the Conn use and watch. They are applied on the server
+	// before DialConfig returns.
+	Use   string
+	Watch []string
+
+	// Reconnect, if non-nil, makes the Conn reconnect automatically
+	// according to it. Its Dial field is ignored; the Conn redials the
+	// same way as DialConfig.
+	Reconnect *ReconnectPolicy
+
+	// Transformers, if set, rewrite the bodies of the jobs put and
+	// read by the Conn, as described by Transformer.
+	Transformers []Transformer
+}
+
+// DialConfig connects addr as described by cfg and then returns a new
+// Conn for the connection. A nil cfg is the same as the zero Config.
+func DialConfig(ctx context.Context, addr string, cfg *Config) (*Conn, error) {
+	if cfg == nil {
+		cfg = new(Config)
+	}
+	dial := func(ctx context.Context) (io.ReadWriteCloser, error) {
+		return cfg.dial(ctx, addr)
+	}
+	var c *Conn
+	if cfg.Reconnect != nil {
+		p := *cfg.Reconnect
+		p.Dial = dial
+		var err error
+		c, err = NewReconnectingConnContext(ctx, p)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		rwc, err := dial(ctx)
+		if err != nil {
+			return nil, err
+		}
+		c = NewConn(rwc)
+	}
+	c.rTimeout = cfg.ReadTimeout
+	c.wTimeout = cfg.WriteTimeout
+	c.SetTransformers(cfg.Transformers...)
+	if cfg.Use != "" {
+		c.Tube.Name = cfg.Use
+	}
+	if len(cfg.Watch) > 0 {
+		c.TubeSet = *NewTubeSet(c, cfg.Watch...)
+	}
+	if err := c.applyTubes(ctx); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (cfg *Config) dial(ctx context.Context, addr string) (net.Conn, error) {
+	network := cfg.Network
+	if network == "" {
+		network = "tcp"
+	}
+	var conn net.Conn
+	var err error
+	switch {
+	case cfg.DialFunc != nil:
+		conn, err = cfg.DialFunc(ctx, network, addr)
+	case cfg.Dialer != nil:
+		conn, err = cfg.Dialer.DialContext(ctx, network, addr)
+	default:
+		dialer := &net.Dialer{
+			Timeout:   DefaultDialTimeout,
+			KeepAlive: DefaultKeepAlivePeriod,
+		}
+		conn, err = dialer.DialContext(ctx, network, addr)
+	}
+	if err != nil || cfg.TLS == nil {
+		return conn, err
+	}
+	tlsConfig := cfg.TLS
+	if tlsConfig.ServerName == "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			host = addr
+		}
+		tlsConfig = tlsConfig.Clone()
+		tlsConfig.ServerName = host
+	}
+	tlsConn := tls.Client(conn, tlsConfig)
+	if err = tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// applyTubes sends the use, watch and ignore commands for the default
+// Tube and TubeSet of c right away, instead of ahead of the first
+// command that needs them.
+func (c *Conn) applyTubes(ctx context.Context) error {
+	r, err := c.startRequest(ctx, "use")
+	if err != nil {
+		return err
+	}
+	defer c.p.EndRequest(r.id)
+	n, err := c.adjustTubes(&c.Tube, &c.TubeSet)
+	if err != nil {
+		c.p.SkipResponse(r.id)
+		return err
+	}
+	c.p.StartResponse(r.id) // nothing else can be in flight yet
+	defer c.p.EndResponse(r.id)
+	if err = c.replay(ctx, n); err != nil {
+		c.abandon()
+		return ConnError{c, r.op, err}
+	}
+	return nil
+}
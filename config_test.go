@@ -0,0 +1,173 @@
+package beanstalk
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// serveListener serves s on l until l is closed.
+func (s *mockServer) serveListener(l net.Listener) {
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go s.serve(c)
+	}
+}
+
+// testCert returns a self-signed certificate for 127.0.0.1.
+func testCert(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "beanstalk test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
+
+func TestDialConfigTLS(t *testing.T) {
+	cert, roots := testCert(t)
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go newMockServer().serveListener(l)
+
+	c, err := DialConfig(context.Background(), l.Addr().String(), &Config{
+		TLS:   &tls.Config{RootCAs: roots},
+		Use:   "foo",
+		Watch: []string{"bar"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	used, err := c.ListTubeUsed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if used != "foo" {
+		t.Fatalf("expected %#v, got %#v", "foo", used)
+	}
+	watched, err := c.ListTubesWatched()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(watched, []string{"bar"}) {
+		t.Fatalf("expected %#v, got %#v", []string{"bar"}, watched)
+	}
+}
+
+func TestDialConfigTLSUntrusted(t *testing.T) {
+	cert, _ := testCert(t)
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go newMockServer().serveListener(l)
+
+	_, err = DialConfig(context.Background(), l.Addr().String(), &Config{TLS: &tls.Config{}})
+	if err == nil {
+		t.Fatal("expected certificate error")
+	}
+}
+
+func TestDialConfigUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "beanstalkd.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go newMockServer().serveListener(l)
+
+	c, err := DialConfig(context.Background(), path, &Config{Network: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, err = c.Put([]byte("x"), 0, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDialConfigReadTimeout(t *testing.T) {
+	cli, srv := net.Pipe()
+	defer srv.Close()
+	go func() {
+		b := make([]byte, 64)
+		for {
+			if _, err := srv.Read(b); err != nil {
+				return
+			}
+		}
+	}()
+	c, err := DialConfig(context.Background(), "ignored", &Config{
+		DialFunc: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return cli, nil
+		},
+		ReadTimeout: 20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	err = c.Delete(1)
+	if e, ok := err.(ConnError); !ok || !isTimeout(e.Err) {
+		t.Fatal("expected timeout, got", err)
+	}
+	if err = c.Delete(1); !errors.Is(err, ErrUnusable) {
+		t.Fatal("expected ErrUnusable, got", err)
+	}
+}
+
+func TestDialConfigBadTube(t *testing.T) {
+	s := newMockServer()
+	_, err := DialConfig(context.Background(), "ignored", &Config{
+		DialFunc: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			rwc, err := s.DialRaw(ctx)
+			return rwc.(net.Conn), err
+		},
+		Use: "*",
+	})
+	if e, ok := err.(NameError); !ok || e.Err != ErrBadChar {
+		t.Fatal("expected NameError, got", err)
+	}
+}
@@ -2,10 +2,12 @@ package beanstalk
 
 import (
 	"bufio"
-	"bytes"
+	"context"
 	"io"
 	"net"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -19,15 +21,41 @@ const DefaultKeepAlivePeriod = 10 * time.Second
 // of a default Tube and TubeSet as well as the underlying network
 // connection. The embedded types carry methods with them; see the
 // documentation of those types for details.
+//
+// A Conn is safe for concurrent use by multiple goroutines. Commands
+// are written to the server and their responses read back strictly
+// in the order in which they were issued.
+//
+// Methods with the Context suffix give up when their context is done.
+// A command abandoned before it was sent leaves the Conn as it was,
+// and so does one whose response had not started to arrive: that
+// response is read and discarded in the background, and a job it
+// reserved is released again. The server cannot be told to stop
+// waiting, though, so the commands sent after an abandoned reserve
+// wait for it to end. If the context interrupts a response part way
+// through on a connection that supports deadlines, such as a
+// net.Conn, the Conn loses its place in the protocol stream; later
+// commands fail with ErrUnusable and the Conn should be closed. The
+// deadline of the context is also applied to the connection.
 type Conn struct {
-	c       io.ReadWriteCloser
-	w       *bufio.Writer
-	r       *bufio.Reader
-	used    string
-	watched map[string]bool
-	buf     []byte
-	lineBuf []byte
-	fmtBuf  [32]byte
+	mu        sync.Mutex // guards c while it is replaced, and closed
+	c         io.ReadWriteCloser
+	closed    bool
+	keepAlive map[uint64]*KeepAlive // guarded by mu
+	claims    map[uint64][]claim    // guarded by mu
+	transform []Transformer         // guarded by mu
+	reconnect *ReconnectPolicy
+	p         pipeline
+	w         *bufio.Writer // guarded by the request side of p
+	r         *bufio.Reader // guarded by the response side of p
+	discard   func()        // reads the current response for nobody; guarded by the response side of p
+	used      string
+	watched   map[string]bool
+	lineBuf   []byte
+	fmtBuf    [32]byte
+	rTimeout  time.Duration // per-response read timeout, if any
+	wTimeout  time.Duration // per-request write timeout, if any
+	unusable  int32         // accessed atomically
 	Tube
 	TubeSet
 }
@@ -168,8 +196,6 @@ var (
 	nl         = []byte{'\n'}
 	colonSpace = []byte{':', ' '}
 	minusSpace = []byte{'-', ' '}
-	watching   = []byte{'W', 'A', 'T', 'C', 'H', 'I', 'N', 'G', ' '}
-	using      = []byte{'U', 'S', 'I', 'N', 'G', ' '}
 
 	statToIdx = map[string]int{
 		"current-jobs-urgent":      nStatsCurrentJobsUrgent,
@@ -256,11 +282,15 @@ func Dial(network, addr string) (*Conn, error) {
 // DialTimeout connects addr on the given network using net.DialTimeout
 // with a supplied timeout and then returns a new Conn for the connection.
 func DialTimeout(network, addr string, timeout time.Duration) (*Conn, error) {
+	return dialContext(context.Background(), network, addr, timeout)
+}
+
+func dialContext(ctx context.Context, network, addr string, timeout time.Duration) (*Conn, error) {
 	dialer := &net.Dialer{
 		Timeout:   timeout,
 		KeepAlive: DefaultKeepAlivePeriod,
 	}
-	c, err := dialer.Dial(network, addr)
+	c, err := dialer.DialContext(ctx, network, addr)
 	if err != nil {
 		return nil, err
 	}
@@ -269,59 +299,218 @@ func DialTimeout(network, addr string, timeout time.Duration) (*Conn, error) {
 
 // Close closes the underlying network connection.
 func (c *Conn) Close() error {
-	return c.c.Close()
+	c.mu.Lock()
+	c.closed = true
+	rwc := c.c
+	ka := c.keepAlive
+	c.keepAlive = nil
+	c.mu.Unlock()
+	for _, k := range ka {
+		k.halt()
+	}
+	return rwc.Close()
+}
+
+// abandon marks c unusable. It is called when I/O failed or was
+// interrupted part way through a command, leaving c at an unknown
+// position in the protocol stream.
+func (c *Conn) abandon() {
+	atomic.StoreInt32(&c.unusable, 1)
+}
+
+func (c *Conn) usable() bool {
+	return atomic.LoadInt32(&c.unusable) == 0
+}
+
+// ioError abandons c and returns a ConnError for err, an I/O error
+// during op. If c reconnects automatically, the error is ErrConnReset
+// unless ctx itself interrupted the I/O.
+func (c *Conn) ioError(ctx context.Context, op string, err error) error {
+	c.abandon()
+	if ctx.Err() != nil {
+		err = ctx.Err()
+	} else if d, ok := ctx.Deadline(); ok && isTimeout(err) && !time.Now().Before(d) {
+		// The connection deadline fired just ahead of ctx.
+		err = context.DeadlineExceeded
+	} else if c.reconnect != nil {
+		err = ErrConnReset
+	}
+	return ConnError{c, op, err}
+}
+
+// unusableError returns the error recorded for commands that find c
+// abandoned when they are about to read a response.
+func (c *Conn) unusableError() error {
+	if c.reconnect != nil {
+		return ErrConnReset
+	}
+	return ErrUnusable
+}
+
+// startRequest assigns an id to a new request for op and waits for
+// its turn to be sent. On success the caller holds the request turn
+// and must end it with c.p.EndRequest.
+func (c *Conn) startRequest(ctx context.Context, op string) (req, error) {
+	r := req{id: c.p.Next(), op: op}
+	err := c.p.StartRequestContext(ctx, r.id)
+	if err != nil {
+		return req{}, ConnError{c, op, err}
+	}
+	if err = ctx.Err(); err == nil && !c.usable() {
+		if c.reconnect != nil {
+			err = c.redial(ctx, r)
+		} else {
+			err = ErrUnusable
+		}
+	}
+	if err != nil {
+		c.p.SkipResponse(r.id)
+		c.p.EndRequest(r.id)
+		return req{}, ConnError{c, op, err}
+	}
+	return r, nil
+}
+
+func (c *Conn) cmdTube(ctx context.Context, t *Tube, ts *TubeSet, body []byte, op, s string, args ...uint64) (req, error) {
+	var src *bodySource
+	if body != nil {
+		src = &bodySource{b: body, size: int64(len(body))}
+	}
+	return c.cmdSource(ctx, t, ts, src, op, s, args...)
 }
 
-func (c *Conn) cmdTube(t *Tube, ts *TubeSet, body []byte, op, s string, args ...uint64) (req, error) {
-	err := c.adjustTubes(t, ts)
+// A bodySource supplies the body of a put command.
+type bodySource struct {
+	b    []byte
+	r    io.Reader // if not nil, size bytes are copied from r instead of b
+	size int64
+	err  error // the error reading r, if any
+}
+
+func (s *bodySource) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	if err != nil && err != io.EOF {
+		s.err = err
+	}
+	return n, err
+}
+
+// cmdSource is like cmdTube, but the body, if any, comes from src.
+func (c *Conn) cmdSource(ctx context.Context, t *Tube, ts *TubeSet, src *bodySource, op, s string, args ...uint64) (req, error) {
+	r, err := c.startRequest(ctx, op)
+	if err != nil {
+		return req{}, err
+	}
+	defer c.p.EndRequest(r.id)
+
+	// The writer passes large bodies straight on to the connection, so
+	// watch the whole command and not just the flush.
+	stop := c.watchWrite(ctx)
+	r.skip, err = c.writeCmd(ctx, t, ts, src, op, s, args...)
+	stop()
 	if err != nil {
+		c.p.SkipResponse(r.id)
 		return req{}, err
 	}
+	return r, nil
+}
+
+// writeCmd writes and flushes a command, after the use, watch and
+// ignore commands for t and ts, and returns how many of those it
+// wrote. The caller watches the write.
+func (c *Conn) writeCmd(ctx context.Context, t *Tube, ts *TubeSet, src *bodySource, op, s string, args ...uint64) (skip int, err error) {
+	skip, err = c.adjustTubes(t, ts)
+	if err != nil {
+		return 0, err
+	}
 	c.print(op, s, args...)
-	if body != nil {
+	if src != nil {
 		c.w.Write(space)
-		c.w.Write(strconv.AppendUint(c.fmtBuf[:0], uint64(len(body)), 10))
+		c.w.Write(strconv.AppendUint(c.fmtBuf[:0], uint64(src.size), 10))
 		c.w.Write(crnl)
-		c.w.Write(body)
+		if src.r == nil {
+			c.w.Write(src.b)
+		} else if err = c.copyBody(ctx, op, src); err != nil {
+			return 0, err
+		}
 	}
 	c.w.Write(crnl)
-	err = c.w.Flush()
+	return skip, c.flush(ctx, op)
+}
+
+// copyBody copies the body of a put command from src to the
+// connection. A failure part way through leaves the server waiting for
+// the rest of the body, so c is abandoned.
+func (c *Conn) copyBody(ctx context.Context, op string, src *bodySource) error {
+	n, err := io.Copy(c.w, io.LimitReader(src, src.size))
+	if src.err != nil {
+		c.abandon()
+		return ConnError{c, op, src.err}
+	}
 	if err != nil {
-		return req{}, ConnError{c, op, err}
+		return c.ioError(ctx, op, err)
+	}
+	if n < src.size {
+		c.abandon()
+		return ConnError{c, op, io.ErrUnexpectedEOF}
 	}
-	return req{op}, nil
+	return nil
 }
 
-func (c *Conn) cmd(t *Tube, ts *TubeSet, body []byte, op string, args ...uint64) (req, error) {
-	return c.cmdTube(t, ts, body, op, "", args...)
+// flush flushes the writer of c. The caller watches the write, from
+// the first byte of the request, with watchWrite.
+func (c *Conn) flush(ctx context.Context, op string) error {
+	if err := c.w.Flush(); err != nil {
+		return c.ioError(ctx, op, err)
+	}
+	return nil
 }
 
-func (c *Conn) adjustTubes(t *Tube, ts *TubeSet) error {
-	if t != nil && t.Name != c.used {
+func (c *Conn) cmd(ctx context.Context, t *Tube, ts *TubeSet, body []byte, op string, args ...uint64) (req, error) {
+	return c.cmdTube(ctx, t, ts, body, op, "", args...)
+}
+
+// adjustTubes writes the use, watch and ignore commands needed to make
+// the server's view of c match t and ts, and returns how many of them
+// it wrote. Nothing is written if any of the names is malformed.
+func (c *Conn) adjustTubes(t *Tube, ts *TubeSet) (n int, err error) {
+	useTube := t != nil && t.Name != c.used
+	if useTube {
 		if err := CheckName(t.Name); err != nil {
-			return err
+			return 0, err
 		}
-		c.printLine("use", t.Name)
-		c.used = t.Name
 	}
 	if ts != nil {
 		for s := range ts.Name {
 			if !c.watched[s] {
 				if err := CheckName(s); err != nil {
-					return err
+					return 0, err
 				}
+			}
+		}
+	}
+	if useTube {
+		c.printLine("use", t.Name)
+		c.used = t.Name
+		n++
+	}
+	if ts != nil {
+		for s := range ts.Name {
+			if !c.watched[s] {
 				c.printLine("watch", s)
 				c.watched[s] = true
+				n++
 			}
 		}
 		for s := range c.watched {
 			if !ts.Name[s] {
 				c.printLine("ignore", s)
 				delete(c.watched, s)
+				n++
 			}
 		}
 	}
-	return nil
+	return n, nil
 }
 
 func (c *Conn) print(cmd, t string, args ...uint64) {
@@ -341,27 +530,111 @@ func (c *Conn) printLine(cmd, t string, args ...uint64) {
 	c.w.Write(crnl)
 }
 
+// readLine reads a line. On error, c.lineBuf holds what was read of
+// it.
 func (c *Conn) readLine() ([]byte, error) {
 	c.lineBuf = c.lineBuf[:0] // reset last line
 	for {
 		s, err := c.r.ReadSlice('\n')
+		c.lineBuf = append(c.lineBuf, s...)
 		if err == nil {
-			c.lineBuf = append(c.lineBuf, s...)
 			return c.lineBuf[:len(c.lineBuf)-2], nil
 		} else if err != bufio.ErrBufferFull {
 			return nil, err
 		}
-		c.lineBuf = append(c.lineBuf, s...)
 	}
 }
 
-func (c *Conn) readRawResp(r req, readBody bool) (header []byte, body []byte, err error) {
+// startResponse waits for the turn to read the response to r. If ctx
+// is done first, the response is read and discarded in the background
+// once its turn comes, so that c stays in step with the server. A job
+// reserved by a discarded response is released again.
+func (c *Conn) startResponse(ctx context.Context, r req, readBody bool) error {
+	discard := func() {
+		// The caller has given up; don't touch its buffers or writer.
+		r.sink = bodySink{}
+		header, _, err := c.readRawResp(context.Background(), r, readBody)
+		var args [1]uint64
+		if err == nil && readBody && c.scan(header, "RESERVED", args[:]) == nil {
+			// The release needs the response turn we hold.
+			go c.releaseLost(args[0])
+		}
+	}
+	if err := c.startResponseDiscard(ctx, r, discard); err != nil {
+		return err
+	}
+	c.discard = discard
+	return nil
+}
+
+// releaseLost releases a job that was reserved for a caller who gave
+// up waiting for it, so that it does not stay reserved by c, out of
+// everyone's sight, until its TTR runs out. The job keeps its priority.
+// If its stats cannot be read, it is left for the server to release.
+func (c *Conn) releaseLost(id uint64) {
+	ctx := context.Background()
+	st, err := c.statsJob(ctx, id)
+	if err != nil {
+		return
+	}
+	c.ReleaseContext(ctx, id, uint32(st.Pri), 0)
+}
+
+// startResponseDiscard is like startResponse, but calls discard to
+// read and throw away the response if ctx is done first. Unlike with
+// startResponse, a response that ctx interrupts once its turn has come
+// leaves c unusable, even if none of it had arrived.
+func (c *Conn) startResponseDiscard(ctx context.Context, r req, discard func()) error {
+	err := c.p.StartResponseContext(ctx, r.id)
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		go func() {
+			c.p.StartResponse(r.id)
+			defer c.p.EndResponse(r.id)
+			if c.usable() {
+				discard()
+			}
+		}()
+		return ConnError{c, r.op, err}
+	}
+	if !c.usable() {
+		c.p.EndResponse(r.id)
+		return ConnError{c, r.op, c.unusableError()}
+	}
+	c.discard = nil
+	return nil
+}
+
+// readRawResp reads the response to r. The caller must hold the
+// response turn for r.id; header is only valid until it releases it.
+// If ctx interrupts the response before any of it has arrived, and
+// startResponse began it, the rest is handed to its discard function
+// in the background; c stays usable, and the EndResponse of the caller
+// is ignored.
+func (c *Conn) readRawResp(ctx context.Context, r req, readBody bool) (header []byte, body []byte, err error) {
+	stop := c.watchRead(ctx, r.block)
+	defer func() {
+		if stop != nil {
+			stop()
+		}
+	}()
+	// Skip the replies to the use, watch and ignore commands that
+	// adjustTubes sent ahead of r.
 	line, err := c.readLine()
-	for bytes.HasPrefix(line, watching) || bytes.HasPrefix(line, using) {
+	if err != nil && len(c.lineBuf) == 0 && ctx.Err() != nil && isTimeout(err) && c.discard != nil {
+		// Clear the deadline set by ctx before the discard reads on.
+		stop()
+		stop = nil
+		c.handOff(r)
+		return nil, nil, ConnError{c, r.op, ctx.Err()}
+	}
+	for i := 0; i < r.skip && err == nil; i++ {
 		line, err = c.readLine()
 	}
 	if err != nil {
-		return nil, nil, ConnError{c, r.op, err}
+		return nil, nil, c.ioError(ctx, r.op, err)
 	}
 	header = line
 	if readBody {
@@ -370,25 +643,103 @@ func (c *Conn) readRawResp(r req, readBody bool) (header []byte, body []byte, er
 		if err != nil {
 			return nil, nil, ConnError{c, r.op, err}
 		}
-		if c.buf == nil || len(c.buf) < size+2 {
-			c.buf = make([]byte, size+2) // include trailing CR NL
+		body, err = c.readBody(ctx, r, size)
+	}
+	return
+}
+
+// handOff hands the response to r, none of which has been read, to the
+// discard function of c in the background, along with the response
+// turn.
+func (c *Conn) handOff(r req) {
+	discard := c.discard
+	c.discard = nil
+	c.p.HandOffResponse(r.id)
+	go func() {
+		defer c.p.EndResponse(r.id)
+		discard()
+	}()
+}
+
+// A bodySink says where readRawResp puts a response body. The zero
+// bodySink puts it in a newly allocated slice: the body is handed to
+// the caller after the response turn ends, so it must not share memory
+// with the next response.
+type bodySink struct {
+	dst    []byte      // if not nil, reused when large enough
+	w      *sinkWriter // if not nil, the body is copied here instead
+	stream *BodyReader // if not nil, the body is left for it to read
+}
+
+// readBody reads a body of the given size, followed by CR NL, into the
+// sink of r.
+func (c *Conn) readBody(ctx context.Context, r req, size int) ([]byte, error) {
+	var body []byte
+	if r.sink.stream != nil {
+		r.sink.stream.Size = int64(size)
+		r.sink.stream.lr.N = int64(size)
+		return nil, nil
+	} else if r.sink.w != nil {
+		lr := &io.LimitedReader{R: c.r, N: int64(size)}
+		_, err := io.Copy(r.sink.w, lr)
+		if r.sink.w.err != nil {
+			// Keep c in step with the server despite the failed
+			// writer, and let the caller report its error.
+			_, err = c.r.Discard(int(lr.N))
+		} else if err == nil && lr.N > 0 {
+			err = io.ErrUnexpectedEOF
 		}
-		_, err = io.ReadFull(c.r, c.buf[:size+2])
 		if err != nil {
-			return header, nil, ConnError{c, r.op, err}
+			return nil, c.ioError(ctx, r.op, err)
+		}
+	} else {
+		body = r.sink.dst
+		if cap(body) < size {
+			body = make([]byte, size)
+		}
+		body = body[:size]
+		if _, err := io.ReadFull(c.r, body); err != nil {
+			return nil, c.ioError(ctx, r.op, err)
 		}
-		body = c.buf[:size] // exclude trailing CR NL
 	}
-	return
+	if _, err := c.r.Discard(2); err != nil { // trailing CR NL
+		return nil, c.ioError(ctx, r.op, err)
+	}
+	return body, nil
+}
+
+// A sinkWriter records the error of its writer, telling it apart from
+// errors reading the connection. Once the writer fails, the rest of
+// the body is discarded and the command otherwise succeeds.
+type sinkWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (w *sinkWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	if err == nil && n < len(p) {
+		err = io.ErrShortWrite
+	}
+	if err != nil {
+		w.err = err
+	}
+	return n, err
 }
 
-func (c *Conn) readResp(r req, readBody bool, cmd string) ([]byte, error) {
+func (c *Conn) readResp(ctx context.Context, r req, readBody bool, cmd string) ([]byte, error) {
 	var args [0]uint64
-	return c.readRespArgs(r, readBody, cmd, args[:])
+	return c.readRespArgs(ctx, r, readBody, cmd, args[:])
 }
 
-func (c *Conn) readRespArgs(r req, readBody bool, cmd string, args []uint64) ([]byte, error) {
-	header, body, err := c.readRawResp(r, readBody)
+func (c *Conn) readRespArgs(ctx context.Context, r req, readBody bool, cmd string, args []uint64) ([]byte, error) {
+	err := c.startResponse(ctx, r, readBody)
+	if err != nil {
+		return nil, err
+	}
+	defer c.p.EndResponse(r.id)
+
+	header, body, err := c.readRawResp(ctx, r, readBody)
 	if err != nil {
 		return nil, err
 	}
@@ -399,14 +750,79 @@ func (c *Conn) readRespArgs(r req, readBody bool, cmd string, args []uint64) ([]
 	return body, nil
 }
 
-// Delete deletes the given job.
+// Delete deletes the given job. If c reserved the job and a
+// ClaimCheck stored its body, the blob is deleted too.
 func (c *Conn) Delete(id uint64) error {
-	r, err := c.cmd(nil, nil, nil, "delete", id)
+	return c.DeleteContext(context.Background(), id)
+}
+
+// DeleteContext is like Delete, but takes a context.
+func (c *Conn) DeleteContext(ctx context.Context, id uint64) error {
+	settled := c.settle(id)
+	r, err := c.cmd(ctx, nil, nil, nil, "delete", id)
 	if err != nil {
+		settled(false)
 		return err
 	}
-	_, err = c.readResp(r, false, "DELETED")
-	return err
+	_, err = c.readResp(ctx, r, false, "DELETED")
+	claims := settled(err == nil)
+	if err != nil {
+		return err
+	}
+	return deleteClaims(ctx, claims)
+}
+
+// DeleteAsync is like Delete, but returns as soon as the command has
+// been sent.
+func (c *Conn) DeleteAsync(id uint64) *Future {
+	settled := c.settle(id)
+	r, err := c.cmd(context.Background(), nil, nil, nil, "delete", id)
+	if err != nil {
+		settled(false)
+	}
+	read := c.readAsync(false, "DELETED", false)
+	return c.async(r, err, func(r req) (uint64, []byte, error) {
+		_, _, err := read(r)
+		claims := settled(err == nil)
+		if err == nil {
+			err = deleteClaims(context.Background(), claims)
+		}
+		return 0, nil, err
+	})
+}
+
+// settle notes that a command that deletes, releases or buries the
+// job with the given id is about to be sent. The returned function is
+// called with whether the command succeeded. If so, the job is no
+// longer reserved by c: its KeepAlive, if any, is stopped, and the
+// blobs recorded for it by decodeReserved are returned and forgotten.
+// If not, both are kept. A touch that fails while the command is in
+// flight ends the KeepAlive without an error.
+func (c *Conn) settle(id uint64) (done func(ok bool) []claim) {
+	c.mu.Lock()
+	k := c.keepAlive[id]
+	if k != nil {
+		k.settling++
+	}
+	c.mu.Unlock()
+	return func(ok bool) (claims []claim) {
+		c.mu.Lock()
+		if k != nil {
+			k.settling--
+		}
+		if ok {
+			claims = c.claims[id]
+			delete(c.claims, id)
+			if k != nil && c.keepAlive[id] == k {
+				delete(c.keepAlive, id)
+			}
+		}
+		c.mu.Unlock()
+		if ok && k != nil {
+			k.halt()
+		}
+		return claims
+	}
 }
 
 // Release tells the server to perform the following actions:
@@ -414,65 +830,267 @@ func (c *Conn) Delete(id uint64) error {
 // jobs reserved by c, wait delay seconds, then place the job in the
 // ready queue, which makes it available for reservation by any client.
 func (c *Conn) Release(id uint64, pri uint32, delay time.Duration) error {
-	r, err := c.cmd(nil, nil, nil, "release", id, uint64(pri), dur(delay))
+	return c.ReleaseContext(context.Background(), id, pri, delay)
+}
+
+// ReleaseContext is like Release, but takes a context.
+func (c *Conn) ReleaseContext(ctx context.Context, id uint64, pri uint32, delay time.Duration) error {
+	settled := c.settle(id)
+	r, err := c.cmd(ctx, nil, nil, nil, "release", id, uint64(pri), dur(delay))
 	if err != nil {
+		settled(false)
 		return err
 	}
-	_, err = c.readResp(r, false, "RELEASED")
+	_, err = c.readResp(ctx, r, false, "RELEASED")
+	settled(err == nil)
 	return err
 }
 
+// ReleaseAsync is like Release, but returns as soon as the command has
+// been sent.
+func (c *Conn) ReleaseAsync(id uint64, pri uint32, delay time.Duration) *Future {
+	settled := c.settle(id)
+	r, err := c.cmd(context.Background(), nil, nil, nil, "release", id, uint64(pri), dur(delay))
+	if err != nil {
+		settled(false)
+	}
+	read := c.readAsync(false, "RELEASED", false)
+	return c.async(r, err, func(r req) (uint64, []byte, error) {
+		_, _, err := read(r)
+		settled(err == nil)
+		return 0, nil, err
+	})
+}
+
 // Bury places the given job in a holding area in the job's tube and
 // sets its priority to pri. The job will not be scheduled again until it
 // has been kicked; see also the documentation of Kick.
 func (c *Conn) Bury(id uint64, pri uint32) error {
-	r, err := c.cmd(nil, nil, nil, "bury", id, uint64(pri))
+	return c.BuryContext(context.Background(), id, pri)
+}
+
+// BuryContext is like Bury, but takes a context.
+func (c *Conn) BuryContext(ctx context.Context, id uint64, pri uint32) error {
+	settled := c.settle(id)
+	r, err := c.cmd(ctx, nil, nil, nil, "bury", id, uint64(pri))
 	if err != nil {
+		settled(false)
 		return err
 	}
-	_, err = c.readResp(r, false, "BURIED")
+	_, err = c.readResp(ctx, r, false, "BURIED")
+	settled(err == nil)
 	return err
 }
 
+// BuryAsync is like Bury, but returns as soon as the command has
+// been sent.
+func (c *Conn) BuryAsync(id uint64, pri uint32) *Future {
+	settled := c.settle(id)
+	r, err := c.cmd(context.Background(), nil, nil, nil, "bury", id, uint64(pri))
+	if err != nil {
+		settled(false)
+	}
+	read := c.readAsync(false, "BURIED", false)
+	return c.async(r, err, func(r req) (uint64, []byte, error) {
+		_, _, err := read(r)
+		settled(err == nil)
+		return 0, nil, err
+	})
+}
+
 // KickJob places the given job to the ready queue of the same tube where it currently belongs
 // when the given job id exists and is in a buried or delayed state.
 func (c *Conn) KickJob(id uint64) error {
-	r, err := c.cmd(nil, nil, nil, "kick-job", id)
+	return c.KickJobContext(context.Background(), id)
+}
+
+// KickJobContext is like KickJob, but takes a context.
+func (c *Conn) KickJobContext(ctx context.Context, id uint64) error {
+	r, err := c.cmd(ctx, nil, nil, nil, "kick-job", id)
 	if err != nil {
 		return err
 	}
-	_, err = c.readResp(r, false, "KICKED")
+	_, err = c.readResp(ctx, r, false, "KICKED")
 	return err
 }
 
+// KickJobAsync is like KickJob, but returns as soon as the command has
+// been sent.
+func (c *Conn) KickJobAsync(id uint64) *Future {
+	r, err := c.cmd(context.Background(), nil, nil, nil, "kick-job", id)
+	return c.async(r, err, c.readAsync(false, "KICKED", false))
+}
+
 // Touch resets the reservation timer for the given job.
 // It is an error if the job isn't currently reserved by c.
 // See the documentation of Reserve for more details.
 func (c *Conn) Touch(id uint64) error {
-	r, err := c.cmd(nil, nil, nil, "touch", id)
+	return c.TouchContext(context.Background(), id)
+}
+
+// TouchContext is like Touch, but takes a context.
+func (c *Conn) TouchContext(ctx context.Context, id uint64) error {
+	r, err := c.cmd(ctx, nil, nil, nil, "touch", id)
 	if err != nil {
 		return err
 	}
-	_, err = c.readResp(r, false, "TOUCHED")
+	_, err = c.readResp(ctx, r, false, "TOUCHED")
 	return err
 }
 
+// TouchAsync is like Touch, but returns as soon as the command has
+// been sent.
+func (c *Conn) TouchAsync(id uint64) *Future {
+	r, err := c.cmd(context.Background(), nil, nil, nil, "touch", id)
+	return c.async(r, err, c.readAsync(false, "TOUCHED", false))
+}
+
 // Peek gets a copy of the specified job from the server.
 func (c *Conn) Peek(id uint64) (body []byte, err error) {
-	r, err := c.cmd(nil, nil, nil, "peek", id)
+	return c.PeekContext(context.Background(), id)
+}
+
+// PeekContext is like Peek, but takes a context.
+func (c *Conn) PeekContext(ctx context.Context, id uint64) (body []byte, err error) {
+	j, err := c.PeekJobContext(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return j.Body, nil
+}
+
+// PeekInto is like Peek, but reads the body into dst if it is large
+// enough, so that the returned body aliases dst. Otherwise a new slice
+// is allocated, as by Peek.
+func (c *Conn) PeekInto(id uint64, dst []byte) (body []byte, err error) {
+	return c.PeekIntoContext(context.Background(), id, dst)
+}
+
+// PeekIntoContext is like PeekInto, but takes a context.
+func (c *Conn) PeekIntoContext(ctx context.Context, id uint64, dst []byte) (body []byte, err error) {
+	body, err = c.peekSink(ctx, id, bodySink{dst: dst})
+	if err != nil {
+		return nil, err
+	}
+	_, body, err = c.decodeJob(ctx, id, body)
+	return body, err
+}
+
+// PeekTo is like Peek, but copies the body to w as it is read from the
+// connection, without buffering it whole. An error from w is returned
+// as is, and leaves c usable. The body is copied as stored, without
+// undoing envelopes or Transformers.
+func (c *Conn) PeekTo(id uint64, w io.Writer) error {
+	return c.PeekToContext(context.Background(), id, w)
+}
+
+// PeekToContext is like PeekTo, but takes a context.
+func (c *Conn) PeekToContext(ctx context.Context, id uint64, w io.Writer) error {
+	sw := &sinkWriter{w: w}
+	if _, err := c.peekSink(ctx, id, bodySink{w: sw}); err != nil {
+		return err
+	}
+	return sw.err
+}
+
+func (c *Conn) peekSink(ctx context.Context, id uint64, sink bodySink) ([]byte, error) {
+	r, err := c.cmd(ctx, nil, nil, nil, "peek", id)
 	if err != nil {
 		return nil, err
 	}
+	r.sink = sink
 	var args [1]uint64
-	return c.readRespArgs(r, true, "FOUND", args[:])
+	return c.readRespArgs(ctx, r, true, "FOUND", args[:])
+}
+
+// PeekJob is like Peek, but returns the job as a Job. The Tube of the
+// Job is not known and left empty.
+func (c *Conn) PeekJob(id uint64) (*Job, error) {
+	return c.PeekJobContext(context.Background(), id)
+}
+
+// PeekJobContext is like PeekJob, but takes a context.
+func (c *Conn) PeekJobContext(ctx context.Context, id uint64) (*Job, error) {
+	var body []byte
+	err := c.idempotent(func() (err error) {
+		body, err = c.peek(ctx, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	h, body, err := c.decodeJob(ctx, id, body)
+	if err != nil {
+		return nil, err
+	}
+	return &Job{Id: id, Body: body, Header: h, Conn: c}, nil
+}
+
+func (c *Conn) peek(ctx context.Context, id uint64) (body []byte, err error) {
+	r, err := c.cmd(ctx, nil, nil, nil, "peek", id)
+	if err != nil {
+		return nil, err
+	}
+	var args [1]uint64
+	return c.readRespArgs(ctx, r, true, "FOUND", args[:])
+}
+
+// ReserveJob reserves the given job by id, regardless of the tubes
+// watched by c, and returns its body. It requires beanstalkd 1.12 or
+// later. If the job does not exist or is already reserved, ReserveJob
+// returns a ConnError recording ErrNotFound. A job whose body cannot be
+// decoded is buried or released, as by TubeSet.Reserve.
+func (c *Conn) ReserveJob(id uint64) (body []byte, err error) {
+	return c.ReserveJobContext(context.Background(), id)
+}
+
+// ReserveJobContext is like ReserveJob, but takes a context.
+func (c *Conn) ReserveJobContext(ctx context.Context, id uint64) (body []byte, err error) {
+	body, err = c.reserveJob(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	_, body, err = c.decodeReserved(ctx, id, body)
+	return body, err
+}
+
+// reserveJob reserves the given job and returns its body as stored.
+func (c *Conn) reserveJob(ctx context.Context, id uint64) ([]byte, error) {
+	r, err := c.cmd(ctx, nil, nil, nil, "reserve-job", id)
+	if err != nil {
+		return nil, err
+	}
+	var args [1]uint64
+	return c.readRespArgs(ctx, r, true, "RESERVED", args[:])
+}
+
+// PeekAsync is like Peek, but returns as soon as the command has
+// been sent.
+func (c *Conn) PeekAsync(id uint64) *Future {
+	r, err := c.cmd(context.Background(), nil, nil, nil, "peek", id)
+	return c.async(r, err, c.readAsync(true, "FOUND", true))
 }
 
 func (c *Conn) Stats() (Stats, error) {
-	r, err := c.cmd(nil, nil, nil, "stats")
+	return c.StatsContext(context.Background())
+}
+
+// StatsContext is like Stats, but takes a context.
+func (c *Conn) StatsContext(ctx context.Context) (Stats, error) {
+	var res Stats
+	err := c.idempotent(func() (err error) {
+		res, err = c.stats(ctx)
+		return err
+	})
+	return res, err
+}
+
+func (c *Conn) stats(ctx context.Context) (Stats, error) {
+	r, err := c.cmd(ctx, nil, nil, nil, "stats")
 	if err != nil {
 		return Stats{}, err
 	}
-	body, err := c.readResp(r, true, "OK")
+	body, err := c.readResp(ctx, r, true, "OK")
 	if err != nil {
 		return Stats{}, err
 	}
@@ -543,11 +1161,25 @@ func (c *Conn) Stats() (Stats, error) {
 
 // StatsJob retrieves statistics about the given job.
 func (c *Conn) StatsJob(id uint64) (JobStats, error) {
-	r, err := c.cmd(nil, nil, nil, "stats-job", id)
+	return c.StatsJobContext(context.Background(), id)
+}
+
+// StatsJobContext is like StatsJob, but takes a context.
+func (c *Conn) StatsJobContext(ctx context.Context, id uint64) (JobStats, error) {
+	var res JobStats
+	err := c.idempotent(func() (err error) {
+		res, err = c.statsJob(ctx, id)
+		return err
+	})
+	return res, err
+}
+
+func (c *Conn) statsJob(ctx context.Context, id uint64) (JobStats, error) {
+	r, err := c.cmd(ctx, nil, nil, nil, "stats-job", id)
 	if err != nil {
 		return JobStats{}, err
 	}
-	body, err := c.readResp(r, true, "OK")
+	body, err := c.readResp(ctx, r, true, "OK")
 	if err != nil {
 		return JobStats{}, err
 	}
@@ -582,20 +1214,158 @@ func (c *Conn) StatsJob(id uint64) (JobStats, error) {
 // ListTubes returns the names of the tubes that currently
 // exist on the server.
 func (c *Conn) ListTubes() ([]string, error) {
-	r, err := c.cmd(nil, nil, nil, "list-tubes")
+	return c.ListTubesContext(context.Background())
+}
+
+// ListTubesContext is like ListTubes, but takes a context.
+func (c *Conn) ListTubesContext(ctx context.Context) ([]string, error) {
+	var res []string
+	err := c.idempotent(func() (err error) {
+		res, err = c.listTubes(ctx)
+		return err
+	})
+	return res, err
+}
+
+func (c *Conn) listTubes(ctx context.Context) ([]string, error) {
+	r, err := c.cmd(ctx, nil, nil, nil, "list-tubes")
+	if err != nil {
+		return nil, err
+	}
+	body, err := c.readResp(ctx, r, true, "OK")
+	return parseList(body), err
+}
+
+// ListTubeUsed returns the name of the tube that the server currently
+// puts new jobs into for c.
+func (c *Conn) ListTubeUsed() (string, error) {
+	return c.ListTubeUsedContext(context.Background())
+}
+
+// ListTubeUsedContext is like ListTubeUsed, but takes a context.
+func (c *Conn) ListTubeUsedContext(ctx context.Context) (string, error) {
+	var res string
+	err := c.idempotent(func() (err error) {
+		res, err = c.listTubeUsed(ctx)
+		return err
+	})
+	return res, err
+}
+
+func (c *Conn) listTubeUsed(ctx context.Context) (string, error) {
+	r, err := c.cmd(ctx, nil, nil, nil, "list-tube-used")
+	if err != nil {
+		return "", err
+	}
+	err = c.startResponse(ctx, r, false)
+	if err != nil {
+		return "", err
+	}
+	defer c.p.EndResponse(r.id)
+	return c.readUsing(ctx, r)
+}
+
+// ListTubesWatched returns the names of the tubes that the server
+// currently reserves jobs from for c.
+func (c *Conn) ListTubesWatched() ([]string, error) {
+	return c.ListTubesWatchedContext(context.Background())
+}
+
+// ListTubesWatchedContext is like ListTubesWatched, but takes a context.
+func (c *Conn) ListTubesWatchedContext(ctx context.Context) ([]string, error) {
+	var res []string
+	err := c.idempotent(func() (err error) {
+		res, err = c.listTubesWatched(ctx)
+		return err
+	})
+	return res, err
+}
+
+func (c *Conn) listTubesWatched(ctx context.Context) ([]string, error) {
+	r, err := c.cmd(ctx, nil, nil, nil, "list-tubes-watched")
 	if err != nil {
 		return nil, err
 	}
-	body, err := c.readResp(r, true, "OK")
+	body, err := c.readResp(ctx, r, true, "OK")
 	return parseList(body), err
 }
 
+// Sync asks the server which tube c is using and which tubes it is
+// watching, and resets the record c keeps of them to match. That
+// record decides which use, watch and ignore commands are sent ahead
+// of other commands, so Sync repairs a Conn whose record has drifted
+// from the server, for example after a raw command was sent on it.
+func (c *Conn) Sync() error {
+	return c.SyncContext(context.Background())
+}
+
+// SyncContext is like Sync, but takes a context.
+func (c *Conn) SyncContext(ctx context.Context) error {
+	r, err := c.startRequest(ctx, "sync")
+	if err != nil {
+		return err
+	}
+	// Hold the request turn until the answers are in, so that no
+	// command is sent based on the record that is being replaced.
+	defer c.p.EndRequest(r.id)
+
+	stop := c.watchWrite(ctx)
+	c.printLine("list-tube-used", "")
+	c.printLine("list-tubes-watched", "")
+	err = c.flush(ctx, r.op)
+	stop()
+	if err != nil {
+		c.p.SkipResponse(r.id)
+		return err
+	}
+	err = c.startResponseDiscard(ctx, r, func() {
+		c.readRawResp(context.Background(), r, false)
+		c.readRawResp(context.Background(), r, true)
+	})
+	if err != nil {
+		return err
+	}
+	defer c.p.EndResponse(r.id)
+
+	used, err := c.readUsing(ctx, r)
+	header, body, err2 := c.readRawResp(ctx, r, true)
+	if err != nil {
+		return err
+	}
+	if err2 != nil {
+		return err2
+	}
+	if err = c.scan(header, "OK", nil); err != nil {
+		return ConnError{c, r.op, err}
+	}
+	c.used = used
+	c.watched = make(map[string]bool)
+	for _, s := range parseList(body) {
+		c.watched[s] = true
+	}
+	return nil
+}
+
+func (c *Conn) readUsing(ctx context.Context, r req) (string, error) {
+	header, _, err := c.readRawResp(ctx, r, false)
+	if err != nil {
+		return "", err
+	}
+	err = c.scan(header, "USING ", nil)
+	if err == nil && len(header) == len("USING ") {
+		err = unknownRespError(string(header))
+	}
+	if err != nil {
+		return "", ConnError{c, r.op, err}
+	}
+	return string(header[len("USING "):]), nil
+}
+
 func (c *Conn) scan(input []byte, cmd string, args []uint64) (err error) {
-	pre := append(c.fmtBuf[:0], cmd...)
-	if !bytes.HasPrefix(input, pre) {
+	if len(input) < len(cmd) || string(input[:len(cmd)]) != cmd {
 		return findRespError(input)
 	}
-	s := input[len(pre):]
+	s := input[len(cmd):]
 	for i := 0; i < len(args); i++ {
 		if len(s) == 0 || s[0] != ' ' {
 			return unknownRespError(string(input))
@@ -610,5 +1380,13 @@ func (c *Conn) scan(input []byte, cmd string, args []uint64) (err error) {
 }
 
 type req struct {
-	op string
+	id   uint
+	op   string
+	skip int // replies to tube adjustments preceding the response
+
+	// block is how long the server may hold the response back on
+	// purpose, as reserve does, or -1 if it may do so indefinitely.
+	block time.Duration
+
+	sink bodySink // where the body of the response goes
 }
@@ -1,6 +1,16 @@
 package beanstalk
 
 import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -187,6 +197,93 @@ func TestPeekTwice(t *testing.T) {
 	}
 }
 
+func TestPeekBodySurvivesLaterCommands(t *testing.T) {
+	c := NewConn(mock(
+		"peek 1\r\npeek 2\r\n",
+		"FOUND 1 3\r\nabc\r\nFOUND 2 3\r\nxyz\r\n",
+	))
+
+	body1, err := c.Peek(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body2, err := c.Peek(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body1) != "abc" || string(body2) != "xyz" {
+		t.Fatalf("got %q and %q", body1, body2)
+	}
+}
+
+func TestPeekInto(t *testing.T) {
+	c := NewConn(mock(
+		"peek 1\r\npeek 1\r\n",
+		"FOUND 1 3\r\nabc\r\nFOUND 1 3\r\nabc\r\n",
+	))
+
+	dst := make([]byte, 8)
+	body, err := c.PeekInto(1, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "abc" || &body[0] != &dst[0] {
+		t.Fatalf("expected body in dst, got %q", body)
+	}
+
+	small := make([]byte, 2)
+	if body, err = c.PeekInto(1, small); err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "abc" || string(small) != "\x00\x00" {
+		t.Fatalf("expected new body, got %q and %q", body, small)
+	}
+}
+
+func TestPeekTo(t *testing.T) {
+	c := NewConn(mock("peek 1\r\n", "FOUND 1 3\r\nabc\r\n"))
+
+	var b strings.Builder
+	if err := c.PeekTo(1, &b); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != "abc" {
+		t.Fatalf("got %q", b.String())
+	}
+}
+
+type failWriter struct{ n int }
+
+func (w *failWriter) Write(p []byte) (int, error) {
+	if len(p) > w.n {
+		p = p[:w.n]
+	}
+	w.n -= len(p)
+	if w.n == 0 {
+		return len(p), errors.New("disk full")
+	}
+	return len(p), nil
+}
+
+func TestPeekToWriterError(t *testing.T) {
+	c := NewConn(mock(
+		"peek 1\r\npeek 2\r\n",
+		"FOUND 1 3\r\nabc\r\nFOUND 2 1\r\nx\r\n",
+	))
+
+	err := c.PeekTo(1, &failWriter{n: 1})
+	if err == nil || err.Error() != "disk full" {
+		t.Fatal("expected writer error, got", err)
+	}
+	body, err := c.Peek(2)
+	if err != nil {
+		t.Fatal("expected Conn to stay usable, got", err)
+	}
+	if string(body) != "x" {
+		t.Fatalf("got %q", body)
+	}
+}
+
 func TestRelease(t *testing.T) {
 	c := NewConn(mock("release 1 3 2\r\n", "RELEASED\r\n"))
 
@@ -362,3 +459,375 @@ func TestTouch(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestConcurrentUse(t *testing.T) {
+	const (
+		workers = 16
+		rounds  = 50
+	)
+	c := newMockServer().Conn()
+	defer c.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := fmt.Sprintf("tube-%d", i)
+			tube := Tube{c, name}
+			ts := NewTubeSet(c, name)
+			for j := 0; j < rounds; j++ {
+				body := fmt.Sprintf("%s-%d", name, j)
+				id, err := tube.Put([]byte(body), 0, 0, 0)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				got, err := c.Peek(id)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if string(got) != body {
+					t.Errorf("peek %d: expected %q, got %q", id, body, got)
+					return
+				}
+				id, got, err = ts.Reserve(0)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if !strings.HasPrefix(string(got), name+"-") {
+					t.Errorf("reserved job %d from wrong tube: %q", id, got)
+					return
+				}
+				if err = c.Delete(id); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestConcurrentBodies(t *testing.T) {
+	c := newMockServer().Conn()
+	defer c.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			body := strings.Repeat(strconv.Itoa(i), 100+i)
+			id, err := c.Put([]byte(body), 0, 0, 0)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			var kept [][]byte
+			for j := 0; j < 20; j++ {
+				got, err := c.Peek(id)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				kept = append(kept, got)
+			}
+			for _, got := range kept {
+				if string(got) != body {
+					t.Errorf("body of job %d was overwritten: %q", id, got)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestNameErrorKeepsConnUsable(t *testing.T) {
+	c := newMockServer().Conn()
+	defer c.Close()
+
+	if _, err := (&Tube{c, "*"}).Put([]byte("x"), 0, 0, 0); err == nil {
+		t.Fatal("expected name error")
+	}
+	id, err := c.Put([]byte("x"), 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Delete(id); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestContextCanceledBeforeSend(t *testing.T) {
+	c := NewConn(mock("delete 2\r\n", "DELETED\r\n"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := c.DeleteContext(ctx, 1)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatal("expected context.Canceled, got", err)
+	}
+	if err = c.Delete(2); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestContextDeadlineDuringRead(t *testing.T) {
+	cli, srv := net.Pipe()
+	defer srv.Close()
+	c := NewConn(cli)
+	defer c.Close()
+	r := bufio.NewReader(srv)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	reserved := make(chan error)
+	go func() {
+		_, _, err := c.ReserveContext(ctx, time.Hour)
+		reserved <- err
+	}()
+	if line, _ := r.ReadString('\n'); line != "reserve-with-timeout 3600\r\n" {
+		t.Fatalf("unexpected command %q", line)
+	}
+	if err := <-reserved; !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal("expected context.DeadlineExceeded, got", err)
+	}
+
+	// Nothing of the response had arrived, so c is still usable. The
+	// reserve goes on in the background, and the job it gets is
+	// released before later commands are answered.
+	deleted := make(chan error)
+	go func() {
+		deleted <- c.Delete(1)
+	}()
+	if line, _ := r.ReadString('\n'); line != "delete 1\r\n" {
+		t.Fatalf("unexpected command %q", line)
+	}
+	io.WriteString(srv, "RESERVED 5 1\r\nx\r\nDELETED\r\n")
+	if err := <-deleted; err != nil {
+		t.Fatal(err)
+	}
+	if line, _ := r.ReadString('\n'); line != "stats-job 5\r\n" {
+		t.Fatalf("unexpected command %q", line)
+	}
+	body := "---\nid: 5\npri: 7\n"
+	fmt.Fprintf(srv, "OK %d\r\n%s\r\n", len(body), body)
+	if line, _ := r.ReadString('\n'); line != "release 5 7 0\r\n" {
+		t.Fatalf("unexpected command %q", line)
+	}
+	io.WriteString(srv, "RELEASED\r\n")
+}
+
+func TestContextDeadlineDuringResponse(t *testing.T) {
+	cli, srv := net.Pipe()
+	defer srv.Close()
+	c := NewConn(cli)
+	defer c.Close()
+	go func() {
+		bufio.NewReader(srv).ReadString('\n')
+		io.WriteString(srv, "RESERVED 5 1") // and no more
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, _, err := c.ReserveContext(ctx, time.Hour)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal("expected context.DeadlineExceeded, got", err)
+	}
+	if err = c.Delete(1); !errors.Is(err, ErrUnusable) {
+		t.Fatal("expected ErrUnusable, got", err)
+	}
+}
+
+func TestContextDeadlineDuringWrite(t *testing.T) {
+	cli, srv := net.Pipe()
+	defer srv.Close() // never read
+	c := NewConn(cli)
+	defer c.Close()
+
+	// The body is too big for the writer, so it blocks before the flush.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := c.PutContext(ctx, make([]byte, 1<<16), 0, 0, time.Minute)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal("expected context.DeadlineExceeded, got", err)
+	}
+}
+
+func TestContextCanceledWaitingForTurn(t *testing.T) {
+	cli, srv := net.Pipe()
+	defer srv.Close()
+	c := NewConn(cli)
+	defer c.Close()
+	r := bufio.NewReader(srv)
+
+	reserved := make(chan error)
+	go func() {
+		_, _, err := c.Reserve(time.Hour)
+		reserved <- err
+	}()
+	if line, _ := r.ReadString('\n'); line != "reserve-with-timeout 3600\r\n" {
+		t.Fatalf("unexpected command %q", line)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	deleted := make(chan error)
+	go func() {
+		deleted <- c.DeleteContext(ctx, 1)
+	}()
+	if line, _ := r.ReadString('\n'); line != "delete 1\r\n" {
+		t.Fatalf("unexpected command %q", line)
+	}
+	cancel()
+	if err := <-deleted; !errors.Is(err, context.Canceled) {
+		t.Fatal("expected context.Canceled, got", err)
+	}
+
+	// The reserve response, then the abandoned delete response, which
+	// must be discarded rather than handed to the next command.
+	io.WriteString(srv, "RESERVED 5 1\r\nx\r\nNOT_FOUND\r\n")
+	if err := <-reserved; err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		r.ReadString('\n')
+		io.WriteString(srv, "TOUCHED\r\n")
+	}()
+	if err := c.Touch(5); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestContextCanceledReserveReleased(t *testing.T) {
+	cli, srv := net.Pipe()
+	defer srv.Close()
+	c := NewConn(cli)
+	defer c.Close()
+	r := bufio.NewReader(srv)
+
+	touched := make(chan error)
+	go func() {
+		touched <- c.Touch(1)
+	}()
+	if line, _ := r.ReadString('\n'); line != "touch 1\r\n" {
+		t.Fatalf("unexpected command %q", line)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	reserved := make(chan error)
+	go func() {
+		_, _, err := c.ReserveContext(ctx, time.Hour)
+		reserved <- err
+	}()
+	if line, _ := r.ReadString('\n'); line != "reserve-with-timeout 3600\r\n" {
+		t.Fatalf("unexpected command %q", line)
+	}
+	cancel()
+	if err := <-reserved; !errors.Is(err, context.Canceled) {
+		t.Fatal("expected context.Canceled, got", err)
+	}
+
+	// Nobody will see the job reserved for the abandoned command, so
+	// it must be released again at its own priority.
+	io.WriteString(srv, "TOUCHED\r\nRESERVED 5 1\r\nx\r\n")
+	if err := <-touched; err != nil {
+		t.Fatal(err)
+	}
+	if line, _ := r.ReadString('\n'); line != "stats-job 5\r\n" {
+		t.Fatalf("unexpected command %q", line)
+	}
+	body := "---\nid: 5\npri: 7\n"
+	fmt.Fprintf(srv, "OK %d\r\n%s\r\n", len(body), body)
+	if line, _ := r.ReadString('\n'); line != "release 5 7 0\r\n" {
+		t.Fatalf("unexpected command %q", line)
+	}
+	io.WriteString(srv, "RELEASED\r\n")
+}
+
+func TestReserveJob(t *testing.T) {
+	c := NewConn(mock("reserve-job 3\r\n", "RESERVED 3 1\r\nx\r\n"))
+
+	body, err := c.ReserveJob(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(body) != 1 || body[0] != 'x' {
+		t.Fatalf("bad body, expected %#v, got %#v", "x", string(body))
+	}
+	if err = c.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReserveJobMissing(t *testing.T) {
+	c := NewConn(mock("reserve-job 3\r\n", "NOT_FOUND\r\n"))
+
+	_, err := c.ReserveJob(3)
+	if e, ok := err.(ConnError); !ok || e.Err != ErrNotFound {
+		t.Fatal("expected ErrNotFound, got", err)
+	}
+	if err = c.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestListTubeUsed(t *testing.T) {
+	c := NewConn(mock("list-tube-used\r\n", "USING foo\r\n"))
+
+	s, err := c.ListTubeUsed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != "foo" {
+		t.Fatalf("expected %#v, got %#v", "foo", s)
+	}
+	if err = c.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestListTubesWatched(t *testing.T) {
+	c := NewConn(mock("list-tubes-watched\r\n", "OK 20\r\n---\n- default\n- foo\n\r\n"))
+
+	l, err := c.ListTubesWatched()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(l, []string{"default", "foo"}) {
+		t.Fatalf("expected %#v, got %#v", []string{"default", "foo"}, l)
+	}
+	if err = c.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSync(t *testing.T) {
+	c := NewConn(mock(
+		"list-tube-used\r\nlist-tubes-watched\r\n"+
+			"use default\r\nput 0 0 0 1\r\nx\r\n"+
+			"watch default\r\nignore bar\r\nreserve-with-timeout 0\r\n",
+		"USING foo\r\nOK 10\r\n---\n- bar\n\r\n"+
+			"USING default\r\nINSERTED 1\r\n"+
+			"WATCHING 2\r\nWATCHING 1\r\nRESERVED 1 1\r\nx\r\n",
+	))
+
+	if err := c.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Put([]byte("x"), 0, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := c.Reserve(0); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,159 @@
+package beanstalk
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A CronSchedule is a schedule parsed from a cron expression by
+// ParseCron.
+type CronSchedule struct {
+	minute, hour, dom, month, dow uint64 // bit sets of the allowed values
+
+	// With a restricted day of the month and a restricted day of the
+	// week, a day matches if either does, as in cron. As there, a field
+	// starting with *, such as */2, does not count as restricted.
+	domAny, dowAny bool
+}
+
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var (
+	monthNames = []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+	dayNames   = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+)
+
+// ParseCron parses a cron expression of five fields: minute, hour, day
+// of the month, month and day of the week. Each field is *, a number,
+// a range such as 1-5, or a list of those separated by commas, and any
+// * or range may be followed by a step such as */15. Months and days of
+// the week may also be given by their first three letters, and Sunday
+// is either 0 or 7. The macros @yearly, @monthly, @weekly, @daily and
+// @hourly are accepted too.
+func ParseCron(spec string) (*CronSchedule, error) {
+	if m, ok := cronMacros[strings.ToLower(strings.TrimSpace(spec))]; ok {
+		spec = m
+	}
+	f := strings.Fields(spec)
+	if len(f) != 5 {
+		return nil, fmt.Errorf("beanstalk: cron expression %q does not have 5 fields", spec)
+	}
+	s := new(CronSchedule)
+	var err error
+	for _, p := range []struct {
+		dst      *uint64
+		field    string
+		min, max int
+		names    []string
+	}{
+		{&s.minute, f[0], 0, 59, nil},
+		{&s.hour, f[1], 0, 23, nil},
+		{&s.dom, f[2], 1, 31, nil},
+		{&s.month, f[3], 1, 12, monthNames},
+		{&s.dow, f[4], 0, 7, dayNames},
+	} {
+		if *p.dst, err = parseCronField(p.field, p.min, p.max, p.names); err != nil {
+			return nil, fmt.Errorf("beanstalk: cron expression %q: %v", spec, err)
+		}
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1 // 7 is Sunday too
+	}
+	s.domAny = strings.HasPrefix(f[2], "*")
+	s.dowAny = strings.HasPrefix(f[4], "*")
+	return s, nil
+}
+
+func parseCronField(field string, min, max int, names []string) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("bad step in %q", part)
+			}
+			rng, step = part[:i], n
+		}
+		lo, hi := min, max
+		if rng != "*" {
+			var err error
+			a, b, isRange := strings.Cut(rng, "-")
+			if lo, err = parseCronValue(a, min, max, names); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if isRange {
+				if hi, err = parseCronValue(b, min, max, names); err != nil {
+					return 0, err
+				}
+			} else if step > 1 {
+				hi = max // 5/15 means 5-max/15
+			}
+			if hi < lo {
+				return 0, fmt.Errorf("bad range %q", rng)
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
+
+func parseCronValue(s string, min, max int, names []string) (int, error) {
+	for i, name := range names {
+		if strings.EqualFold(s, name) {
+			return i + min, nil
+		}
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < min || n > max {
+		return 0, fmt.Errorf("bad value %q", s)
+	}
+	return n, nil
+}
+
+// Next returns the first time matched by s that is after t, in the
+// location of t, or the zero Time if there is none in the next five
+// years, as for a schedule such as "0 0 30 2 *".
+func (s *CronSchedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		y, mo, d := t.Date()
+		switch {
+		case s.month&(1<<uint(mo)) == 0:
+			t = time.Date(y, mo+1, 1, 0, 0, 0, 0, loc)
+		case !s.dayMatches(t):
+			t = time.Date(y, mo, d+1, 0, 0, 0, 0, loc)
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(y, mo, d, t.Hour()+1, 0, 0, 0, loc)
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (s *CronSchedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domAny || s.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
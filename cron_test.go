@@ -0,0 +1,61 @@
+package beanstalk
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	from := time.Date(2021, 3, 15, 10, 20, 30, 0, time.UTC) // a Monday
+	for _, tt := range []struct {
+		spec string
+		want string
+	}{
+		{"* * * * *", "2021-03-15 10:21"},
+		{"*/15 * * * *", "2021-03-15 10:30"},
+		{"5 * * * *", "2021-03-15 11:05"},
+		{"0 9-17/4 * * *", "2021-03-15 13:00"},
+		{"0 0 1 * *", "2021-04-01 00:00"},
+		{"0 0 * * sun", "2021-03-21 00:00"},
+		{"0 0 * * 7", "2021-03-21 00:00"},
+		{"30 8 * feb-apr mon,wed", "2021-03-17 08:30"},
+		{"0 0 1 * fri", "2021-03-19 00:00"},   // day of month or of week
+		{"0 0 */2 * mon", "2021-03-29 00:00"}, // a stepped * is unrestricted
+		{"0 0 2 * */3", "2021-05-02 00:00"},
+		{"0 0 29 2 *", "2024-02-29 00:00"},
+		{"@hourly", "2021-03-15 11:00"},
+		{"@yearly", "2022-01-01 00:00"},
+	} {
+		s, err := ParseCron(tt.spec)
+		if err != nil {
+			t.Errorf("ParseCron(%q): %v", tt.spec, err)
+			continue
+		}
+		if got := s.Next(from).Format("2006-01-02 15:04"); got != tt.want {
+			t.Errorf("%q: got %s, want %s", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestCronNextZone(t *testing.T) {
+	loc, err := time.LoadLocation("Asia/Kolkata") // UTC+5:30
+	if err != nil {
+		t.Skip(err)
+	}
+	s, _ := ParseCron("0 * * * *")
+	got := s.Next(time.Date(2021, 3, 15, 10, 20, 0, 0, loc))
+	if want := time.Date(2021, 3, 15, 11, 0, 0, 0, loc); !got.Equal(want) {
+		t.Fatal("got", got, "want", want)
+	}
+}
+
+func TestParseCronErrors(t *testing.T) {
+	for _, spec := range []string{
+		"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *",
+		"* * * 13 *", "* * * * 8", "5-1 * * * *", "*/0 * * * *", "x * * * *",
+	} {
+		if _, err := ParseCron(spec); err == nil {
+			t.Errorf("ParseCron(%q): expected error", spec)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package beanstalk
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrTampered is recorded by a DecodeError for a job whose body
+	// fails the check of an Encrypter or Signer, or lacks one.
+	ErrTampered = errors.New("job body failed authentication")
+
+	// ErrUnknownKey is recorded by a DecodeError for a job whose body
+	// names a key id that the Encrypter or Signer does not have.
+	ErrUnknownKey = errors.New("unknown key id")
+)
+
+// An encrypted or signed body starts with its magic, followed by the
+// length of the key id in one byte and the key id. An encrypted body
+// goes on with the nonce and the sealed body; a signed one with the
+// HMAC-SHA256 of everything else, and the body.
+var (
+	encryptMagic = []byte("\x00BJX")
+	signMagic    = []byte("\x00BJS")
+)
+
+// appendKeyID appends the framing of a body made with the key id to b.
+func appendKeyID(b, magic []byte, id string) ([]byte, error) {
+	if len(id) > 255 {
+		return nil, fmt.Errorf("beanstalk: key id %.16q... is too long", id)
+	}
+	b = append(b, magic...)
+	b = append(b, byte(len(id)))
+	return append(b, id...), nil
+}
+
+// splitKeyID returns the key id of body, and the length of the framing
+// up to the end of it. It returns ok false if body does not start with
+// magic.
+func splitKeyID(body, magic []byte) (id string, n int, ok bool, err error) {
+	if !bytes.HasPrefix(body, magic) {
+		return "", 0, false, nil
+	}
+	n = len(magic)
+	if len(body) <= n || len(body) < n+1+int(body[n]) {
+		return "", 0, true, ErrTampered
+	}
+	id = string(body[n+1 : n+1+int(body[n])])
+	return id, n + 1 + len(id), true, nil
+}
+
+func lookupKey(keys map[string][]byte, id string) ([]byte, error) {
+	key, ok := keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, id)
+	}
+	return key, nil
+}
+
+// An Encrypter is a Transformer that encrypts job bodies with AES-GCM,
+// so that they are not stored in the clear by the server. The body
+// records the id of the key it was encrypted with, so keys can be
+// rotated by adding a new key to Keys, switching KeyID to it once all
+// consumers have it, and removing the old key once the jobs encrypted
+// with it are gone.
+//
+// A body that fails to decrypt, or that is not encrypted at all unless
+// AllowPlaintext is set, is rejected with ErrTampered. Reserving such a
+// job buries it, as described by DecodeError.
+type Encrypter struct {
+	Keys  map[string][]byte // AES keys by id, of 16, 24 or 32 bytes
+	KeyID string            // the id of the key to encrypt with
+
+	// AllowPlaintext makes Decode pass through bodies that are not
+	// encrypted, such as while producers are switched over.
+	AllowPlaintext bool
+}
+
+func (e *Encrypter) aead(id string) (cipher.AEAD, error) {
+	key, err := lookupKey(e.Keys, id)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Encode encrypts body with the key named by KeyID.
+func (e *Encrypter) Encode(ctx context.Context, tube string, body []byte) ([]byte, error) {
+	aead, err := e.aead(e.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	b, err := appendKeyID(nil, encryptMagic, e.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	n := len(b)
+	b = append(b, make([]byte, aead.NonceSize())...)
+	if _, err := rand.Read(b[n:]); err != nil {
+		return nil, err
+	}
+	// The framing is authenticated too, so the key id cannot be altered.
+	return aead.Seal(b, b[n:], body, b[:n]), nil
+}
+
+// Decode decrypts body with the key it names.
+func (e *Encrypter) Decode(ctx context.Context, body []byte) ([]byte, error) {
+	id, n, ok, err := splitKeyID(body, encryptMagic)
+	if !ok {
+		if e.AllowPlaintext {
+			return body, nil
+		}
+		return nil, ErrTampered
+	} else if err != nil {
+		return nil, err
+	}
+	aead, err := e.aead(id)
+	if err != nil {
+		return nil, err
+	}
+	if len(body) < n+aead.NonceSize() {
+		return nil, ErrTampered
+	}
+	nonce := body[n : n+aead.NonceSize()]
+	plain, err := aead.Open(nil, nonce, body[n+len(nonce):], body[:n])
+	if err != nil {
+		return nil, ErrTampered
+	}
+	return plain, nil
+}
+
+// A Signer is a Transformer that signs job bodies with HMAC-SHA256,
+// leaving them readable, so that bodies altered on the server or by
+// unauthorized producers are detected. Like an Encrypter, it records
+// the id of the key in the body, so keys can be rotated.
+//
+// A body whose signature does not match, or that is not signed at all
+// unless AllowUnsigned is set, is rejected with ErrTampered. Reserving
+// such a job buries it, as described by DecodeError.
+type Signer struct {
+	Keys  map[string][]byte // HMAC keys by id
+	KeyID string            // the id of the key to sign with
+
+	// AllowUnsigned makes Decode pass through bodies that are not
+	// signed, such as while producers are switched over.
+	AllowUnsigned bool
+}
+
+// Encode signs body with the key named by KeyID.
+func (s *Signer) Encode(ctx context.Context, tube string, body []byte) ([]byte, error) {
+	key, err := lookupKey(s.Keys, s.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	b, err := appendKeyID(nil, signMagic, s.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(b)
+	mac.Write(body)
+	b = mac.Sum(b)
+	return append(b, body...), nil
+}
+
+// Decode checks the signature of body and returns it without the
+// signature.
+func (s *Signer) Decode(ctx context.Context, body []byte) ([]byte, error) {
+	id, n, ok, err := splitKeyID(body, signMagic)
+	if !ok {
+		if s.AllowUnsigned {
+			return body, nil
+		}
+		return nil, ErrTampered
+	} else if err != nil {
+		return nil, err
+	}
+	key, err := lookupKey(s.Keys, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(body) < n+sha256.Size {
+		return nil, ErrTampered
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(body[:n])
+	mac.Write(body[n+sha256.Size:])
+	if !hmac.Equal(mac.Sum(nil), body[n:n+sha256.Size]) {
+		return nil, ErrTampered
+	}
+	return body[n+sha256.Size:], nil
+}
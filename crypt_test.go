@@ -0,0 +1,126 @@
+package beanstalk
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+var (
+	testKey1 = bytes.Repeat([]byte{1}, 32)
+	testKey2 = bytes.Repeat([]byte{2}, 16)
+)
+
+func TestEncrypter(t *testing.T) {
+	s := newMockServer()
+	c := s.Conn()
+	defer c.Close()
+	e := &Encrypter{Keys: map[string][]byte{"k1": testKey1}, KeyID: "k1"}
+	c.SetTransformers(e)
+	id, err := c.PutHeader([]byte("secret"), Header{HeaderTraceID: "t"}, 0, 0, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored := s.job(id).body; bytes.Contains(stored, []byte("secret")) || bytes.Contains(stored, []byte("Trace-Id")) {
+		t.Fatalf("expected encrypted body, got %q", stored)
+	}
+
+	// Rotate to a new key; jobs encrypted with the old one still read.
+	e.Keys["k2"] = testKey2
+	e.KeyID = "k2"
+	c.Put([]byte("newer"), 0, 0, time.Minute)
+	for _, want := range []string{"secret", "newer"} {
+		j, err := c.NextJob(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(j.Body) != want {
+			t.Fatalf("got %q, want %q", j.Body, want)
+		}
+		j.Delete()
+	}
+}
+
+func TestEncrypterReject(t *testing.T) {
+	s := newMockServer()
+	c := s.Conn()
+	defer c.Close()
+	e := &Encrypter{Keys: map[string][]byte{"k1": testKey1}, KeyID: "k1"}
+	c.SetTransformers(e)
+	id, _ := c.Put([]byte("secret"), 0, 0, time.Minute)
+	s.job(id).body[len(s.job(id).body)-1] ^= 1
+	plain := s.put("default", []byte("plain"), 0, 0, 60)
+
+	for _, want := range []uint64{id, plain} {
+		gotId, _, err := c.Reserve(0)
+		var de *DecodeError
+		if !errors.As(err, &de) || !errors.Is(err, ErrTampered) || !de.Buried || gotId != want {
+			t.Fatal("expected tampered job to be buried, got", gotId, err)
+		}
+		if s.job(want).state != "buried" {
+			t.Fatal("expected job to be buried, got", s.job(want).state)
+		}
+	}
+
+	e.AllowPlaintext = true
+	c.KickJob(plain)
+	if _, body, err := c.Reserve(0); err != nil || string(body) != "plain" {
+		t.Fatal("expected plaintext to pass, got", err)
+	}
+}
+
+func TestEncrypterUnknownKey(t *testing.T) {
+	s := newMockServer()
+	c := s.Conn()
+	defer c.Close()
+	c.SetTransformers(&Encrypter{Keys: map[string][]byte{"k2": testKey2}, KeyID: "k2"})
+	id, _ := c.Put([]byte("x"), 0, 0, time.Minute)
+	c.SetTransformers(&Encrypter{Keys: map[string][]byte{"k1": testKey1}, KeyID: "k1"})
+	if _, err := c.Peek(id); !errors.Is(err, ErrUnknownKey) {
+		t.Fatal("expected ErrUnknownKey, got", err)
+	}
+	if s.job(id).state != "ready" {
+		t.Fatal("expected peeked job to be left alone")
+	}
+}
+
+func TestSigner(t *testing.T) {
+	s := newMockServer()
+	c := s.Conn()
+	defer c.Close()
+	sg := &Signer{Keys: map[string][]byte{"k1": testKey1}, KeyID: "k1"}
+	c.SetTransformers(sg)
+	good, _ := c.Put([]byte("hello"), 0, 0, time.Minute)
+	if stored := s.job(good).body; !bytes.HasSuffix(stored, []byte("hello")) {
+		t.Fatalf("expected readable body, got %q", stored)
+	}
+	bad, _ := c.Put([]byte("hello"), 0, 0, time.Minute)
+	body := s.job(bad).body
+	body[len(body)-1] = 'O'
+
+	if body, err := c.ReserveJob(good); err != nil || string(body) != "hello" {
+		t.Fatal("expected signed body back, got", err)
+	}
+	_, _, err := c.Reserve(0)
+	var de *DecodeError
+	if !errors.As(err, &de) || de.Id != bad || !errors.Is(err, ErrTampered) || !de.Buried {
+		t.Fatal("expected tampered job to be buried, got", err)
+	}
+}
+
+func TestSignerUnsigned(t *testing.T) {
+	s := newMockServer()
+	c := s.Conn()
+	defer c.Close()
+	sg := &Signer{Keys: map[string][]byte{"k1": testKey1}, KeyID: "k1"}
+	c.SetTransformers(sg)
+	id := s.put("default", []byte("unsigned"), 0, 0, 60)
+	if _, err := c.Peek(id); !errors.Is(err, ErrTampered) {
+		t.Fatal("expected unsigned body to be rejected, got", err)
+	}
+	sg.AllowUnsigned = true
+	if body, err := c.Peek(id); err != nil || string(body) != "unsigned" {
+		t.Fatal("expected unsigned body to pass, got", err)
+	}
+}
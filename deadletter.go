@@ -0,0 +1,136 @@
+package beanstalk
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// DeadLetterSuffix is appended to the name of a tube to form the name
+// of its dead-letter tube.
+const DeadLetterSuffix = ".dead"
+
+// DeadLetterTube returns the name of the dead-letter tube for tube.
+func DeadLetterTube(tube string) string {
+	return tube + DeadLetterSuffix
+}
+
+// A DeadLetter is a job that was given up on, along with a record of
+// where it came from and why it failed. It is the body of a job in a
+// dead-letter tube, encoded as JSON.
+type DeadLetter struct {
+	Tube     string        `json:"tube"` // the tube the job came from
+	Id       uint64        `json:"id"`   // the id the job had there
+	Reason   string        `json:"reason"`
+	Attempts int           `json:"attempts"`
+	Pri      uint32        `json:"pri"`
+	Ttr      time.Duration `json:"ttr"`
+	Created  time.Time     `json:"created"` // when the job was put, as near as is known
+	Failed   time.Time     `json:"failed"`
+	Header   Header        `json:"header,omitempty"` // see Tube.PutHeader
+	Body     []byte        `json:"body"`
+}
+
+// DecodeDeadLetter decodes the body of a job in a dead-letter tube.
+func DecodeDeadLetter(body []byte) (*DeadLetter, error) {
+	dl := new(DeadLetter)
+	if err := json.Unmarshal(body, dl); err != nil {
+		return nil, err
+	}
+	return dl, nil
+}
+
+// DeadLetterJob moves the job with the given id and body, which must be
+// reserved by c, to the tube dead as a DeadLetter, recording reason as
+// the cause of its failure. The job is deleted only once the
+// DeadLetter has been put; if that fails, the job stays reserved.
+func (c *Conn) DeadLetterJob(id uint64, body []byte, dead string, reason error) error {
+	return c.DeadLetterJobContext(context.Background(), id, body, dead, reason)
+}
+
+// DeadLetterJobContext is like DeadLetterJob, but takes a context.
+func (c *Conn) DeadLetterJobContext(ctx context.Context, id uint64, body []byte, dead string, reason error) error {
+	return c.deadLetter(ctx, id, nil, body, dead, reason)
+}
+
+// DeadLetter is like Conn.DeadLetterJob for j, which must be reserved
+// by j.Conn, but also keeps the headers of j, which are restored when
+// the DeadLetter is replayed.
+func (j *Job) DeadLetter(dead string, reason error) error {
+	return j.DeadLetterContext(context.Background(), dead, reason)
+}
+
+// DeadLetterContext is like DeadLetter, but takes a context.
+func (j *Job) DeadLetterContext(ctx context.Context, dead string, reason error) error {
+	return j.Conn.deadLetter(ctx, j.Id, j.Header, j.Body, dead, reason)
+}
+
+func (c *Conn) deadLetter(ctx context.Context, id uint64, h Header, body []byte, dead string, reason error) error {
+	stats, err := c.StatsJobContext(ctx, id)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	dl := DeadLetter{
+		Tube:     stats.Tube,
+		Id:       id,
+		Attempts: Attempts(stats),
+		Pri:      uint32(stats.Pri),
+		Ttr:      time.Duration(stats.Ttr) * time.Second,
+		Created:  now.Add(-time.Duration(stats.Age) * time.Second),
+		Failed:   now,
+		Header:   h,
+		Body:     body,
+	}
+	if reason != nil {
+		dl.Reason = reason.Error()
+	}
+	b, err := json.Marshal(dl)
+	if err != nil {
+		return err
+	}
+	t := Tube{c, dead}
+	if _, err = t.PutContext(ctx, b, dl.Pri, 0, dl.Ttr); err != nil {
+		return err
+	}
+	return c.DeleteContext(ctx, id)
+}
+
+// ReplayDeadLetters moves up to n DeadLetters from the tube dead back
+// to the tubes they came from, with their original priority, TTR and
+// headers, and returns how many it moved. It stops early when dead has
+// no more ready jobs. A job in dead that is not a DeadLetter is buried,
+// and ReplayDeadLetters returns the decoding error.
+func (c *Conn) ReplayDeadLetters(dead string, n int) (int, error) {
+	return c.ReplayDeadLettersContext(context.Background(), dead, n)
+}
+
+// ReplayDeadLettersContext is like ReplayDeadLetters, but takes a
+// context.
+func (c *Conn) ReplayDeadLettersContext(ctx context.Context, dead string, n int) (int, error) {
+	ts := NewTubeSet(c, dead)
+	for i := 0; i < n; i++ {
+		id, body, err := ts.ReserveContext(ctx, 0)
+		if e, ok := err.(ConnError); ok && e.Err == ErrTimeout {
+			return i, nil
+		} else if err != nil {
+			return i, err
+		}
+		dl, err := DecodeDeadLetter(body)
+		if err != nil {
+			if berr := c.BuryContext(ctx, id, 0); berr != nil {
+				return i, berr
+			}
+			return i, err
+		}
+		t := Tube{c, dl.Tube}
+		if _, err = t.put(ctx, dl.Header, dl.Body, dl.Pri, 0, dl.Ttr); err != nil {
+			c.ReleaseContext(ctx, id, dl.Pri, 0)
+			return i, err
+		}
+		if err = c.DeleteContext(ctx, id); err != nil {
+			return i + 1, err
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,141 @@
+package beanstalk
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDeadLetterJob(t *testing.T) {
+	s := newMockServer()
+	c := s.Conn()
+	defer c.Close()
+	id := s.put("a", []byte("x"), 7, 0, 60)
+	if _, _, err := NewTubeSet(c, "a").Reserve(0); err != nil {
+		t.Fatal(err)
+	}
+
+	before := time.Now()
+	if err := c.DeadLetterJob(id, []byte("x"), DeadLetterTube("a"), errors.New("bad")); err != nil {
+		t.Fatal(err)
+	}
+	if s.job(id) != nil {
+		t.Fatal("expected original job to be deleted")
+	}
+	dead := s.first(map[string]bool{"a.dead": true}, "ready")
+	if dead == nil {
+		t.Fatal("expected job in a.dead")
+	}
+	dl, err := DecodeDeadLetter(dead.body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dl.Tube != "a" || dl.Id != id || dl.Reason != "bad" || dl.Attempts != 1 ||
+		dl.Pri != 7 || dl.Ttr != time.Minute || string(dl.Body) != "x" {
+		t.Fatalf("got %+v", dl)
+	}
+	if dl.Failed.Before(before) || dl.Created.After(dl.Failed) {
+		t.Fatalf("bad timestamps %v, %v", dl.Created, dl.Failed)
+	}
+}
+
+func TestReplayDeadLetters(t *testing.T) {
+	s := newMockServer()
+	c := s.Conn()
+	defer c.Close()
+	for _, body := range []string{"x", "y", "z"} {
+		id := s.put("a", []byte(body), 7, 0, 60)
+		if _, _, err := NewTubeSet(c, "a").Reserve(0); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.DeadLetterJob(id, []byte(body), "a.dead", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, err := c.ReplayDeadLetters("a.dead", 2)
+	if err != nil || n != 2 {
+		t.Fatal("got", n, err)
+	}
+	n, err = c.ReplayDeadLetters("a.dead", 10)
+	if err != nil || n != 1 {
+		t.Fatal("got", n, err)
+	}
+	if s.count("a", "ready") != 3 || s.count("a.dead", "ready") != 0 {
+		t.Fatal("expected all jobs back in a")
+	}
+	j := s.first(map[string]bool{"a": true}, "ready")
+	if string(j.body) != "x" || j.pri != 7 || j.ttr != 60 {
+		t.Fatalf("got %+v", j)
+	}
+}
+
+func TestDeadLetterHeader(t *testing.T) {
+	s := newMockServer()
+	c := s.Conn()
+	defer c.Close()
+	h := Header{"Trace-Id": "t1", HeaderEnqueuedAt: "2020-01-01T00:00:00Z"}
+	if _, err := (&Tube{c, "a"}).PutHeader([]byte("x"), h, 7, 0, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	j, err := NewTubeSet(c, "a").NextJob(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = j.DeadLetter("a.dead", errors.New("bad")); err != nil {
+		t.Fatal(err)
+	}
+	dl, err := DecodeDeadLetter(s.first(map[string]bool{"a.dead": true}, "ready").body)
+	if err != nil || dl.Header["Trace-Id"] != "t1" || string(dl.Body) != "x" {
+		t.Fatalf("got %+v (%v)", dl, err)
+	}
+
+	if n, err := c.ReplayDeadLetters("a.dead", 1); err != nil || n != 1 {
+		t.Fatal("got", n, err)
+	}
+	got, body, err := decodeEnvelope(s.first(map[string]bool{"a": true}, "ready").body)
+	if err != nil || string(body) != "x" || len(got) != len(h) ||
+		got["Trace-Id"] != "t1" || got[HeaderEnqueuedAt] != h[HeaderEnqueuedAt] {
+		t.Fatalf("got header %v, body %q (%v)", got, body, err)
+	}
+}
+
+func TestReplayDeadLettersMalformed(t *testing.T) {
+	s := newMockServer()
+	c := s.Conn()
+	defer c.Close()
+	id := s.put("a.dead", []byte("not json"), 0, 0, 60)
+
+	if n, err := c.ReplayDeadLetters("a.dead", 1); err == nil || n != 0 {
+		t.Fatal("expected decoding error, got", n, err)
+	}
+	if j := s.job(id); j.state != "buried" {
+		t.Fatal("expected malformed dead letter to be buried, got", j.state)
+	}
+}
+
+func TestWorkerDeadLetter(t *testing.T) {
+	s := newMockServer()
+	id := s.put("a", []byte("x"), 0, 0, 60)
+	w := newTestWorker(s, nil)
+	w.RetryPolicy = RetrySchedule{0}
+	w.DeadLetter = DeadLetterTube
+	w.Handle("a", func(ctx context.Context, j *Job) error {
+		return errors.New("try again")
+	})
+	stop := runWorker(t, w)
+	waitFor(t, func() bool { return s.count("a.dead", "ready") == 1 })
+	stop()
+
+	if s.job(id) != nil {
+		t.Fatal("expected original job to be deleted")
+	}
+	dl, err := DecodeDeadLetter(s.first(map[string]bool{"a.dead": true}, "ready").body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dl.Attempts != 2 || dl.Reason != "try again" {
+		t.Fatalf("got %+v", dl)
+	}
+}
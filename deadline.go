@@ -0,0 +1,87 @@
+package beanstalk
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// aLongTimeAgo is a non-zero time, far in the past, used to make
+// blocking I/O fail immediately.
+var aLongTimeAgo = time.Unix(1, 0)
+
+// deadliner is implemented by connections, such as net.Conn, whose
+// blocking I/O can be interrupted with deadlines.
+type deadliner interface {
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+}
+
+// watchContext maps ctx and timeout onto a connection deadline set by
+// setDeadline: the earlier of the deadline of ctx and timeout from now,
+// if any, becomes the connection deadline, and when ctx is done the
+// connection deadline is moved into the past so that blocking I/O
+// returns at once. The returned function stops watching and clears
+// the deadline.
+func watchContext(ctx context.Context, timeout time.Duration, setDeadline func(time.Time) error) (stop func()) {
+	done := ctx.Done()
+	d, ok := ctx.Deadline()
+	if timeout > 0 {
+		if t := time.Now().Add(timeout); !ok || t.Before(d) {
+			d, ok = t, true
+		}
+	}
+	if done == nil && !ok {
+		return func() {}
+	}
+	if ok {
+		setDeadline(d)
+	}
+	if done == nil {
+		return func() { setDeadline(time.Time{}) }
+	}
+	stopc := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		select {
+		case <-done:
+			setDeadline(aLongTimeAgo)
+		case <-stopc:
+		}
+	}()
+	return func() {
+		close(stopc)
+		<-exited
+		setDeadline(time.Time{})
+	}
+}
+
+// watchRead watches ctx and the read timeout of c while a response is
+// read. The read timeout is extended by block, the time the server may
+// hold the response back on purpose, and disabled if block is negative.
+func (c *Conn) watchRead(ctx context.Context, block time.Duration) (stop func()) {
+	d, ok := c.c.(deadliner)
+	if !ok {
+		return func() {}
+	}
+	timeout := c.rTimeout
+	if timeout > 0 && block < 0 {
+		timeout = 0
+	} else if timeout > 0 {
+		timeout += block
+	}
+	return watchContext(ctx, timeout, d.SetReadDeadline)
+}
+
+func (c *Conn) watchWrite(ctx context.Context) (stop func()) {
+	if d, ok := c.c.(deadliner); ok {
+		return watchContext(ctx, c.wTimeout, d.SetWriteDeadline)
+	}
+	return func() {}
+}
+
+func isTimeout(err error) bool {
+	e, ok := err.(net.Error)
+	return ok && e.Timeout()
+}
@@ -0,0 +1,161 @@
+package beanstalk
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// A Header holds the headers of a job put with Tube.PutHeader. They
+// travel with the body in an envelope and are restored into Job.Header
+// when the job is reserved or peeked as a Job.
+type Header map[string]string
+
+// Well-known header names. HeaderEnqueuedAt is set by Tube.PutHeader,
+// and HeaderScheduledAt by a Scheduler to the tick a job is for, for
+// the entries added with Scheduler.AddHeader.
+const (
+	HeaderContentType = "Content-Type"
+	HeaderTraceID     = "Trace-Id"
+	HeaderProducer    = "Producer"
+	HeaderEnqueuedAt  = "Enqueued-At"  // RFC 3339, with nanoseconds
+	HeaderScheduledAt = "Scheduled-At" // RFC 3339
+)
+
+// An envelope is framed as
+//
+//	magic version count (klen key vlen value)* payload
+//
+// where count, klen and vlen are uvarints. Bodies that do not start
+// with the magic are plain legacy bodies with no headers.
+var envelopeMagic = []byte("\x00BJE")
+
+const envelopeVersion = 1
+
+// ErrEnvelopeVersion is recorded by a DecodeError for a job whose
+// envelope has a version this package does not know.
+var ErrEnvelopeVersion = errors.New("unknown envelope version")
+
+// A DecodeError records a job whose body could not be decoded. A job
+// that was peeked is left as it was on the server. A job that was
+// reserved is buried, lest it be reserved again and again, and Buried
+// is set. If decoding may yet succeed, because the context was done or
+// the BlobStore of a ClaimCheck failed other than with fs.ErrNotExist,
+// the job is released instead, and Released is set. If that failed
+// too, the job stays reserved.
+type DecodeError struct {
+	Id       uint64
+	Err      error
+	Buried   bool
+	Released bool
+
+	transient bool // a BlobStore failed, so decoding may yet succeed
+}
+
+func (e *DecodeError) Error() string {
+	switch {
+	case e.Buried:
+		return fmt.Sprintf("decode job %d (buried): %v", e.Id, e.Err)
+	case e.Released:
+		return fmt.Sprintf("decode job %d (released): %v", e.Id, e.Err)
+	}
+	return fmt.Sprintf("decode job %d: %v", e.Id, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+func encodeEnvelope(h Header, payload []byte) []byte {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	b := append([]byte(nil), envelopeMagic...)
+	b = append(b, envelopeVersion)
+	b = binary.AppendUvarint(b, uint64(len(keys)))
+	for _, k := range keys {
+		b = binary.AppendUvarint(b, uint64(len(k)))
+		b = append(b, k...)
+		b = binary.AppendUvarint(b, uint64(len(h[k])))
+		b = append(b, h[k]...)
+	}
+	return append(b, payload...)
+}
+
+// decodeEnvelope returns the headers and payload of body. A body
+// without an envelope, or whose envelope is malformed and so cannot
+// have been made by encodeEnvelope, is returned whole as the payload:
+// it may well be a legacy body that happens to start with the magic.
+// An envelope of a version this package does not know is an error if
+// the rest of it is framed like one of this version, lest a job put by
+// a newer version be handed over with its header bytes left in.
+func decodeEnvelope(body []byte) (Header, []byte, error) {
+	if !bytes.HasPrefix(body, envelopeMagic) || len(body) == len(envelopeMagic) {
+		return nil, body, nil
+	}
+	b := body[len(envelopeMagic):]
+	h, payload, ok := parseEnvelope(b[1:])
+	switch {
+	case !ok:
+		return nil, body, nil
+	case b[0] != envelopeVersion:
+		return nil, nil, ErrEnvelopeVersion
+	}
+	return h, payload, nil
+}
+
+// parseEnvelope parses the headers and payload that follow the magic
+// and version of an envelope, reporting whether they are well formed.
+func parseEnvelope(b []byte) (Header, []byte, bool) {
+	n, k := binary.Uvarint(b)
+	if k <= 0 || n > uint64(len(b)) {
+		return nil, nil, false
+	}
+	b = b[k:]
+	h := make(Header, n)
+	str := func() (string, bool) {
+		l, k := binary.Uvarint(b)
+		if k <= 0 || l > uint64(len(b)-k) {
+			return "", false
+		}
+		s := string(b[k : k+int(l)])
+		b = b[k+int(l):]
+		return s, true
+	}
+	for i := uint64(0); i < n; i++ {
+		key, ok := str()
+		if !ok {
+			return nil, nil, false
+		}
+		if h[key], ok = str(); !ok {
+			return nil, nil, false
+		}
+	}
+	return h, b, true
+}
+
+// PutHeader is like Put, but sends h along with body in an envelope.
+// If h has no HeaderEnqueuedAt, it is set to the current time.
+func (t *Tube) PutHeader(body []byte, h Header, pri uint32, delay, ttr time.Duration) (id uint64, err error) {
+	return t.PutHeaderContext(context.Background(), body, h, pri, delay, ttr)
+}
+
+// PutHeaderContext is like PutHeader, but takes a context.
+func (t *Tube) PutHeaderContext(ctx context.Context, body []byte, h Header, pri uint32, delay, ttr time.Duration) (id uint64, err error) {
+	if _, ok := h[HeaderEnqueuedAt]; !ok {
+		h2 := make(Header, len(h)+1)
+		for k, v := range h {
+			h2[k] = v
+		}
+		h2[HeaderEnqueuedAt] = time.Now().UTC().Format(time.RFC3339Nano)
+		h = h2
+	}
+	return t.put(ctx, h, body, pri, delay, ttr)
+}
@@ -0,0 +1,115 @@
+package beanstalk
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPutHeader(t *testing.T) {
+	s := newMockServer()
+	c := s.Conn()
+	defer c.Close()
+	tube := &Tube{c, "a"}
+	h := Header{HeaderTraceID: "abc", HeaderContentType: "text/plain"}
+	id, err := tube.PutHeader([]byte("x"), h, 0, 0, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := h[HeaderEnqueuedAt]; ok {
+		t.Fatal("expected caller's Header to be left alone")
+	}
+
+	pj, err := tube.PeekReadyJob()
+	if err != nil {
+		t.Fatal(err)
+	}
+	j, err := NewTubeSet(c, "a").NextJob(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, j := range []*Job{pj, j} {
+		if j.Id != id || string(j.Body) != "x" {
+			t.Fatalf("got job %d %q", j.Id, j.Body)
+		}
+		if j.Header[HeaderTraceID] != "abc" || j.Header[HeaderContentType] != "text/plain" {
+			t.Fatal("got headers", j.Header)
+		}
+		at, err := time.Parse(time.RFC3339Nano, j.Header[HeaderEnqueuedAt])
+		if err != nil || time.Since(at) > time.Minute {
+			t.Fatal("bad Enqueued-At", j.Header[HeaderEnqueuedAt], err)
+		}
+	}
+}
+
+func TestReserveEnvelope(t *testing.T) {
+	s := newMockServer()
+	c := s.Conn()
+	defer c.Close()
+	_, err := (&Tube{c, "a"}).PutHeader([]byte("payload"), Header{HeaderProducer: "p"}, 0, 0, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, body, err := NewTubeSet(c, "a").Reserve(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "payload" {
+		t.Fatalf("expected payload only, got %q", body)
+	}
+}
+
+func TestEnvelopeLegacy(t *testing.T) {
+	s := newMockServer()
+	c := s.Conn()
+	defer c.Close()
+	for _, body := range []string{"plain", "\x00BJE", "\x00BJE\x01\x05k"} {
+		s.put("a", []byte(body), 0, 0, 60)
+		j, err := NewTubeSet(c, "a").NextJob(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(j.Body) != body || j.Header != nil {
+			t.Fatalf("got %q %v, want %q", j.Body, j.Header, body)
+		}
+		j.Delete()
+	}
+}
+
+func TestEnvelopeVersion(t *testing.T) {
+	s := newMockServer()
+	c := s.Conn()
+	defer c.Close()
+
+	// Not framed like an envelope: a legacy body.
+	legacy := []byte("\x00BJE\x09rest")
+	id := s.put("a", legacy, 0, 0, 60)
+	j, err := (&Tube{c, "a"}).PeekReadyJob()
+	if err != nil || j.Id != id || !bytes.Equal(j.Body, legacy) || j.Header != nil {
+		t.Fatal("expected a legacy body, got", j, err)
+	}
+	s.jobs[id].state = "buried"
+
+	// Framed like an envelope of an unknown version: an error.
+	newer := encodeEnvelope(Header{"k": "v"}, []byte("p"))
+	newer[len(envelopeMagic)] = envelopeVersion + 1
+	id = s.put("a", newer, 0, 0, 60)
+	_, err = (&Tube{c, "a"}).PeekReadyJob()
+	var de *DecodeError
+	if !errors.As(err, &de) || de.Id != id || !errors.Is(err, ErrEnvelopeVersion) {
+		t.Fatal("expected DecodeError, got", err)
+	}
+}
+
+func TestEnvelopeRoundTrip(t *testing.T) {
+	h := Header{"b": "2", "a": "", "": "empty key"}
+	b := encodeEnvelope(h, []byte("p"))
+	if !bytes.Equal(b, encodeEnvelope(h, []byte("p"))) {
+		t.Fatal("expected stable encoding")
+	}
+	got, payload, err := decodeEnvelope(b)
+	if err != nil || string(payload) != "p" || len(got) != 3 || got["b"] != "2" || got[""] != "empty key" {
+		t.Fatal("got", got, payload, err)
+	}
+}
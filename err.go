@@ -2,6 +2,7 @@ package beanstalk
 
 import (
 	"bytes"
+	"context"
 	"errors"
 )
 
@@ -17,6 +18,22 @@ func (e ConnError) Error() string {
 	return e.Op + ": " + e.Err.Error()
 }
 
+// Unwrap returns the underlying error.
+func (e ConnError) Unwrap() error {
+	return e.Err
+}
+
+// ErrUnusable is recorded by a ConnError for commands on a Conn whose
+// earlier I/O failed or was interrupted part way through a command.
+// Such a Conn has lost its place in the protocol stream and should be
+// closed.
+var ErrUnusable = errors.New("connection unusable")
+
+// ErrConnReset is recorded by a ConnError for a command that was in
+// flight when a reconnecting Conn lost its connection. The command may
+// or may not have taken effect on the server.
+var ErrConnReset = errors.New("connection reset")
+
 // Error messages returned by the server.
 var (
 	ErrBadFormat  = errors.New("bad command format")
@@ -46,6 +63,27 @@ var (
 	resUnknown    = []byte("UNKNOWN_COMMAND")
 )
 
+// isIOError reports whether err is a ConnError caused by a failure of
+// the connection itself, as opposed to an error message from the server
+// or a command abandoned before it was sent.
+func isIOError(err error) bool {
+	e, ok := err.(ConnError)
+	if !ok {
+		return false
+	}
+	switch e.Err {
+	case ErrBadFormat, ErrBuried, ErrDeadline, ErrDraining, ErrInternal,
+		ErrJobTooBig, ErrNoCRLF, ErrNotFound, ErrNotIgnored, ErrOOM,
+		ErrTimeout, ErrUnknown:
+		return false
+	case context.Canceled, context.DeadlineExceeded:
+		// Had the context interrupted I/O, the Conn would have been
+		// marked unusable; otherwise the command was never sent.
+		return !e.Conn.usable()
+	}
+	return true
+}
+
 type unknownRespError string
 
 func (e unknownRespError) Error() string {
@@ -0,0 +1,82 @@
+package beanstalk
+
+import (
+	"context"
+)
+
+// A Future is the pending result of a command sent by one of the
+// Async methods. By the time the Future is returned the command has
+// been written to the server; its response is read in the background,
+// in the same order in which commands were issued on the Conn, so any
+// number of commands may be in flight at once.
+type Future struct {
+	done chan struct{}
+	id   uint64
+	body []byte
+	err  error
+}
+
+// Done returns a channel that is closed once the response has been read.
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait blocks until the response has been read and returns its result.
+// For put, peek and reserve commands id is the id of the job and body
+// is its body, as returned by the corresponding synchronous method.
+// For other commands only err is meaningful.
+func (f *Future) Wait() (id uint64, body []byte, err error) {
+	<-f.done
+	return f.id, f.body, f.err
+}
+
+// Err blocks until the response has been read and returns its error.
+func (f *Future) Err() error {
+	<-f.done
+	return f.err
+}
+
+// async returns a Future that is resolved by calling read once the
+// request r has been sent. If sending failed, err is recorded in the
+// Future right away and read is never called.
+func (c *Conn) async(r req, err error, read func(req) (uint64, []byte, error)) *Future {
+	f := &Future{done: make(chan struct{})}
+	if err != nil {
+		f.err = err
+		close(f.done)
+		return f
+	}
+	go func() {
+		f.id, f.body, f.err = read(r)
+		close(f.done)
+	}()
+	return f
+}
+
+// readAsync returns a read function for async that expects the given
+// response, optionally followed by a job id and a job body, which is
+// decoded.
+func (c *Conn) readAsync(readBody bool, cmd string, withId bool) func(req) (uint64, []byte, error) {
+	return func(r req) (uint64, []byte, error) {
+		var args [1]uint64
+		n := 0
+		if withId {
+			n = 1
+		}
+		body, err := c.readRespArgs(context.Background(), r, readBody, cmd, args[:n])
+		if err != nil {
+			return 0, nil, err
+		}
+		switch {
+		case cmd == "RESERVED":
+			if _, body, err = c.decodeReserved(context.Background(), args[0], body); err != nil {
+				return args[0], nil, err
+			}
+		case readBody:
+			if _, body, err = c.decodeJob(context.Background(), args[0], body); err != nil {
+				return 0, nil, err
+			}
+		}
+		return args[0], body, nil
+	}
+}
@@ -0,0 +1,92 @@
+package beanstalk
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPipelinedCommands(t *testing.T) {
+	c := NewConn(mock(
+		"use foo\r\nput 0 0 0 1\r\na\r\n"+
+			"use bar\r\nput 0 0 0 1\r\nb\r\n"+
+			"watch foo\r\nignore default\r\nreserve-with-timeout 0\r\n"+
+			"peek 2\r\n"+
+			"delete 1\r\n",
+		"USING foo\r\nINSERTED 1\r\n"+
+			"USING bar\r\nINSERTED 2\r\n"+
+			"WATCHING 2\r\nWATCHING 1\r\nRESERVED 1 1\r\na\r\n"+
+			"FOUND 2 1\r\nb\r\n"+
+			"DELETED\r\n",
+	))
+	put1 := (&Tube{c, "foo"}).PutAsync([]byte("a"), 0, 0, 0)
+	put2 := (&Tube{c, "bar"}).PutAsync([]byte("b"), 0, 0, 0)
+	res := NewTubeSet(c, "foo").ReserveAsync(0)
+	peek := c.PeekAsync(2)
+	del := c.DeleteAsync(1)
+
+	if id, _, err := put1.Wait(); err != nil || id != 1 {
+		t.Fatal("put foo:", id, err)
+	}
+	if id, _, err := put2.Wait(); err != nil || id != 2 {
+		t.Fatal("put bar:", id, err)
+	}
+	if id, body, err := res.Wait(); err != nil || id != 1 || string(body) != "a" {
+		t.Fatal("reserve:", id, string(body), err)
+	}
+	if id, body, err := peek.Wait(); err != nil || id != 2 || string(body) != "b" {
+		t.Fatal("peek:", id, string(body), err)
+	}
+	if err := del.Err(); err != nil {
+		t.Fatal("delete:", err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPipelinedErrors(t *testing.T) {
+	c := NewConn(mock(
+		"delete 1\r\ntouch 2\r\n",
+		"NOT_FOUND\r\nTOUCHED\r\n",
+	))
+	bad := (&Tube{c, "*"}).PutAsync([]byte("x"), 0, 0, 0)
+	del := c.DeleteAsync(1)
+	touch := c.TouchAsync(2)
+
+	select {
+	case <-bad.Done():
+	case <-time.After(time.Second):
+		t.Fatal("future for unsent command never resolved")
+	}
+	if _, ok := bad.Err().(NameError); !ok {
+		t.Fatal("expected NameError, got", bad.Err())
+	}
+	if e, ok := del.Err().(ConnError); !ok || e.Err != ErrNotFound {
+		t.Fatal("expected ErrNotFound, got", del.Err())
+	}
+	if err := touch.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPipelinedOrder(t *testing.T) {
+	c := newMockServer().Conn()
+	defer c.Close()
+
+	futures := make([]*Future, 1000)
+	for i := range futures {
+		futures[i] = c.PutAsync([]byte("x"), 0, 0, 0)
+	}
+	for i, f := range futures {
+		id, _, err := f.Wait()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != uint64(i+1) {
+			t.Fatalf("response %d matched to wrong request: id %d", i, id)
+		}
+	}
+}
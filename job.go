@@ -0,0 +1,88 @@
+package beanstalk
+
+import (
+	"context"
+	"time"
+)
+
+// A Job is a job reserved or peeked from the server. Its methods act on
+// the job through the Conn it came from.
+type Job struct {
+	Id   uint64
+	Body []byte // owned by the Job; later commands do not overwrite it
+
+	// Header holds the headers of the job's envelope, or nil if the
+	// job was put without one.
+	Header Header
+
+	// Tube is the tube the job was in when it was reserved or peeked.
+	// It is empty if that is not known, as for jobs from Conn.PeekJob.
+	Tube string
+
+	Conn       *Conn     // the Conn that reserved or peeked the job
+	ReservedAt time.Time // when the job was reserved, by the local clock; zero for peeked jobs
+}
+
+// Delete deletes j from the server.
+func (j *Job) Delete() error {
+	return j.Conn.Delete(j.Id)
+}
+
+// DeleteContext is like Delete, but takes a context.
+func (j *Job) DeleteContext(ctx context.Context) error {
+	return j.Conn.DeleteContext(ctx, j.Id)
+}
+
+// Release releases j, which must be reserved by j.Conn, to be ready
+// again after delay with priority pri. See Conn.Release.
+func (j *Job) Release(pri uint32, delay time.Duration) error {
+	return j.Conn.Release(j.Id, pri, delay)
+}
+
+// ReleaseContext is like Release, but takes a context.
+func (j *Job) ReleaseContext(ctx context.Context, pri uint32, delay time.Duration) error {
+	return j.Conn.ReleaseContext(ctx, j.Id, pri, delay)
+}
+
+// Bury buries j, which must be reserved by j.Conn, with priority pri.
+// See Conn.Bury.
+func (j *Job) Bury(pri uint32) error {
+	return j.Conn.Bury(j.Id, pri)
+}
+
+// BuryContext is like Bury, but takes a context.
+func (j *Job) BuryContext(ctx context.Context, pri uint32) error {
+	return j.Conn.BuryContext(ctx, j.Id, pri)
+}
+
+// Touch resets the time left for j, which must be reserved by j.Conn,
+// to its TTR. See Conn.Touch.
+func (j *Job) Touch() error {
+	return j.Conn.Touch(j.Id)
+}
+
+// TouchContext is like Touch, but takes a context.
+func (j *Job) TouchContext(ctx context.Context) error {
+	return j.Conn.TouchContext(ctx, j.Id)
+}
+
+// KickJob places j, which must be buried or delayed, in the ready
+// queue. See Conn.KickJob.
+func (j *Job) KickJob() error {
+	return j.Conn.KickJob(j.Id)
+}
+
+// KickJobContext is like KickJob, but takes a context.
+func (j *Job) KickJobContext(ctx context.Context) error {
+	return j.Conn.KickJobContext(ctx, j.Id)
+}
+
+// Stats retrieves statistics about j.
+func (j *Job) Stats() (JobStats, error) {
+	return j.Conn.StatsJob(j.Id)
+}
+
+// StatsContext is like Stats, but takes a context.
+func (j *Job) StatsContext(ctx context.Context) (JobStats, error) {
+	return j.Conn.StatsJobContext(ctx, j.Id)
+}
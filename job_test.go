@@ -0,0 +1,99 @@
+package beanstalk
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextJob(t *testing.T) {
+	s := newMockServer()
+	c := s.Conn()
+	defer c.Close()
+	id := s.put("a", []byte("x"), 0, 0, 60)
+
+	before := time.Now()
+	j, err := NewTubeSet(c, "a").NextJob(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j.Id != id || string(j.Body) != "x" || j.Tube != "a" || j.Conn != c || j.ReservedAt.Before(before) {
+		t.Fatalf("got %+v", j)
+	}
+}
+
+func TestNextJobLooksUpTube(t *testing.T) {
+	s := newMockServer()
+	c := s.Conn()
+	defer c.Close()
+	s.put("b", []byte("x"), 0, 0, 60)
+
+	j, err := NewTubeSet(c, "a", "b").NextJob(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j.Tube != "b" {
+		t.Fatal("expected tube b, got", j.Tube)
+	}
+}
+
+func TestJobMethods(t *testing.T) {
+	s := newMockServer()
+	c := s.Conn()
+	defer c.Close()
+	id := s.put("default", []byte("x"), 0, 0, 60)
+	ts := NewTubeSet(c, "default")
+
+	j, err := ts.NextJob(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = j.Touch(); err != nil {
+		t.Fatal(err)
+	}
+	if err = j.Release(3, 0); err != nil {
+		t.Fatal(err)
+	}
+	if j, err = ts.NextJob(0); err != nil {
+		t.Fatal(err)
+	}
+	if err = j.Bury(4); err != nil {
+		t.Fatal(err)
+	}
+	stats, err := j.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.State != "buried" || stats.Pri != 4 || stats.Releases != 1 {
+		t.Fatalf("got %+v", stats)
+	}
+	if err = j.KickJob(); err != nil {
+		t.Fatal(err)
+	}
+	if err = j.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if s.job(id) != nil {
+		t.Fatal("expected job to be deleted")
+	}
+}
+
+func TestPeekJob(t *testing.T) {
+	s := newMockServer()
+	c := s.Conn()
+	defer c.Close()
+	id := s.put("a", []byte("x"), 0, 0, 60)
+
+	j, err := (&Tube{c, "a"}).PeekReadyJob()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j.Id != id || string(j.Body) != "x" || j.Tube != "a" || !j.ReservedAt.IsZero() {
+		t.Fatalf("got %+v", j)
+	}
+	if j, err = c.PeekJob(id); err != nil {
+		t.Fatal(err)
+	}
+	if j.Id != id || string(j.Body) != "x" || j.Tube != "" {
+		t.Fatalf("got %+v", j)
+	}
+}
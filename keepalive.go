@@ -0,0 +1,143 @@
+package beanstalk
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// A KeepAlive touches a reserved job periodically, so that its
+// time-to-run does not run out while it is still being processed.
+type KeepAlive struct {
+	c    *Conn
+	id   uint64
+	once sync.Once
+	stop chan struct{}
+	done chan struct{}
+	err  error
+
+	settling int // commands in flight that settle the job; guarded by c.mu
+}
+
+// KeepAlive starts touching the job with the given id, which must be
+// reserved by c and have time-to-run ttr (see JobStats.Ttr), often
+// enough that the server never considers its deadline soon. Touching
+// stops when Stop is called, when the job is deleted, released or
+// buried through c, when c is closed, or when a touch fails. A touch
+// that fails with ErrNotFound means the job has been lost, typically
+// because its TTR ran out anyway; the error is reported by Err. So is
+// a touch that the server takes longer than the interval between
+// touches to answer, after which the job cannot be relied on either.
+//
+// The server handles the commands on a connection one at a time, so c
+// should not be blocked in a reserve command while the job is kept
+// alive.
+func (c *Conn) KeepAlive(id uint64, ttr time.Duration) *KeepAlive {
+	k := &KeepAlive{
+		c:    c,
+		id:   id,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	c.mu.Lock()
+	if c.keepAlive == nil {
+		c.keepAlive = make(map[uint64]*KeepAlive)
+	}
+	if old := c.keepAlive[id]; old != nil {
+		old.halt()
+	}
+	c.keepAlive[id] = k
+	c.mu.Unlock()
+	go k.run(keepAliveInterval(ttr))
+	return k
+}
+
+// keepAliveInterval returns how often to touch a job with time-to-run
+// ttr. The server sends DEADLINE_SOON during the last second of the
+// TTR, so touch at least twice in the time before that.
+func keepAliveInterval(ttr time.Duration) time.Duration {
+	if ttr < time.Second {
+		ttr = time.Second // the server's minimum
+	}
+	d := ttr - time.Second
+	if d < ttr/2 {
+		d = ttr / 2
+	}
+	return d / 2
+}
+
+func (k *KeepAlive) run(interval time.Duration) {
+	defer close(k.done)
+	// Stopping cancels a touch in flight.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-k.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-k.stop:
+			return
+		case <-t.C:
+		}
+		tctx, tcancel := context.WithTimeout(ctx, interval)
+		err := k.c.TouchContext(tctx, k.id)
+		tcancel()
+		if err != nil {
+			k.c.mu.Lock()
+			if k.c.keepAlive[k.id] == k {
+				delete(k.c.keepAlive, k.id)
+			}
+			settling := k.settling > 0
+			k.c.mu.Unlock()
+			select {
+			case <-k.stop:
+				// The job was settled while the touch was in flight.
+			default:
+				if !settling {
+					k.err = err
+				}
+			}
+			return
+		}
+	}
+}
+
+func (k *KeepAlive) halt() {
+	k.once.Do(func() { close(k.stop) })
+}
+
+// Stop stops touching the job. It does not wait for a touch in
+// flight, which is canceled instead; Done is closed once it has
+// returned.
+func (k *KeepAlive) Stop() {
+	k.c.mu.Lock()
+	if k.c.keepAlive[k.id] == k {
+		delete(k.c.keepAlive, k.id)
+	}
+	k.c.mu.Unlock()
+	k.halt()
+}
+
+// Done returns a channel that is closed when k stops touching the job.
+func (k *KeepAlive) Done() <-chan struct{} {
+	return k.done
+}
+
+// Err returns the error of the touch that made k give up, or nil if k
+// is still running or was stopped. If the job was lost, the error is a
+// ConnError recording ErrNotFound.
+func (k *KeepAlive) Err() error {
+	select {
+	case <-k.done:
+		return k.err
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,157 @@
+package beanstalk
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestKeepAliveInterval(t *testing.T) {
+	for _, tt := range []struct{ ttr, want time.Duration }{
+		{0, 250 * time.Millisecond},
+		{time.Second, 250 * time.Millisecond},
+		{2 * time.Second, 500 * time.Millisecond},
+		{61 * time.Second, 30 * time.Second},
+	} {
+		if got := keepAliveInterval(tt.ttr); got != tt.want {
+			t.Errorf("keepAliveInterval(%v) = %v, want %v", tt.ttr, got, tt.want)
+		}
+	}
+}
+
+func reserveOne(t *testing.T, s *mockServer, c *Conn) uint64 {
+	t.Helper()
+	s.put("default", []byte("x"), 0, 0, 1)
+	id, _, err := c.Reserve(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestKeepAliveTouches(t *testing.T) {
+	s := newMockServer()
+	c := s.Conn()
+	defer c.Close()
+	id := reserveOne(t, s, c)
+
+	k := c.KeepAlive(id, time.Second)
+	waitFor(t, func() bool { return s.job(id).touches >= 2 })
+	k.Stop()
+	n := s.job(id).touches
+	time.Sleep(300 * time.Millisecond)
+	if s.job(id).touches != n {
+		t.Fatal("touched after Stop")
+	}
+	if err := k.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKeepAliveStopsOnDelete(t *testing.T) {
+	s := newMockServer()
+	c := s.Conn()
+	defer c.Close()
+	id := reserveOne(t, s, c)
+
+	k := c.KeepAlive(id, time.Second)
+	if err := c.Delete(id); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-k.Done():
+	case <-time.After(time.Second):
+		t.Fatal("KeepAlive still running after Delete")
+	}
+	if err := k.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKeepAliveSurvivesFailedRelease(t *testing.T) {
+	s := newMockServer()
+	c := s.Conn()
+	defer c.Close()
+	id := reserveOne(t, s, c)
+
+	k := c.KeepAlive(id, time.Second)
+	defer k.Stop()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := c.ReleaseContext(ctx, id, 0, 0); err == nil {
+		t.Fatal("expected error")
+	}
+	select {
+	case <-k.Done():
+		t.Fatal("KeepAlive stopped by a failed Release")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if err := c.Bury(id, 0); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-k.Done():
+	case <-time.After(time.Second):
+		t.Fatal("KeepAlive still running after Bury")
+	}
+}
+
+func TestKeepAliveLost(t *testing.T) {
+	s := newMockServer()
+	c := s.Conn()
+	defer c.Close()
+	id := reserveOne(t, s, c)
+
+	k := c.KeepAlive(id, time.Second)
+	s.mu.Lock()
+	delete(s.jobs, id) // as if its TTR ran out and another Conn deleted it
+	s.mu.Unlock()
+	select {
+	case <-k.Done():
+	case <-time.After(time.Second):
+		t.Fatal("KeepAlive still running after job was lost")
+	}
+	if err := k.Err(); !errors.Is(err, ErrNotFound) {
+		t.Fatal("expected ErrNotFound, got", err)
+	}
+}
+
+func TestKeepAliveUnresponsive(t *testing.T) {
+	cli, srv := net.Pipe()
+	defer srv.Close()
+	go io.Copy(io.Discard, srv) // never respond
+	c := NewConn(cli)
+	defer c.Close()
+
+	k := c.KeepAlive(1, time.Second)
+	time.Sleep(300 * time.Millisecond) // a touch is in flight
+	stopped := make(chan struct{})
+	go func() {
+		k.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Stop waited for an unanswered touch")
+	}
+	select {
+	case <-k.Done():
+	case <-time.After(time.Second):
+		t.Fatal("KeepAlive still running after Stop")
+	}
+
+	// Unstopped, an unanswered touch ends the KeepAlive with an error.
+	k = c.KeepAlive(2, time.Second)
+	select {
+	case <-k.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("KeepAlive still waiting for an unanswered touch")
+	}
+	if k.Err() == nil {
+		t.Fatal("expected an error")
+	}
+}
@@ -0,0 +1,293 @@
+package beanstalk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// MoveOptions selects the jobs moved or copied by Tube.MoveTo and
+// Tube.CopyTo.
+type MoveOptions struct {
+	// State is the state of the jobs to move: "ready", "delayed" or
+	// "buried". If it is empty, buried jobs are moved.
+	State string
+
+	// Filter, if not nil, reports whether to move a job, given the job
+	// as peeked and its statistics.
+	Filter func(j *Job, stats JobStats) bool
+
+	// Limit, if positive, is the most jobs to move.
+	Limit int
+
+	// MaxScan, if positive, is the most job ids a scan asks about
+	// before it gives up; see Tube.MoveTo. If it is zero, the scan
+	// asks about at most DefaultMaxScan ids.
+	MaxScan int
+
+	// DryRun makes MoveTo and CopyTo report the jobs they would move
+	// without putting or deleting anything. A dry run always scans,
+	// and its result is only an estimate: the jobs are listed in the
+	// order in which the server would hand them out as far as their
+	// statistics tell, and buried jobs, whose order they do not tell,
+	// are listed in the order of their ids.
+	DryRun bool
+}
+
+// DefaultMaxScan is the number of job ids a scan asks about when
+// MoveOptions.MaxScan is zero.
+const DefaultMaxScan = 10000
+
+// ErrScanIncomplete is returned, along with the jobs found, by Tube.MoveTo
+// and Tube.CopyTo when a scan ends before it has found as many jobs as
+// the tube statistics count in the state.
+var ErrScanIncomplete = errors.New("beanstalk: scan did not find every job")
+
+// A Moved describes a job moved or copied by Tube.MoveTo or
+// Tube.CopyTo, or one that would have been in a dry run.
+type Moved struct {
+	Id    uint64   // the id of the job in the source tube
+	NewId uint64   // the id of the job in the destination tube; 0 in a dry run
+	Stats JobStats // the statistics of the job before it was moved
+}
+
+// MoveTo moves the jobs in t selected by opts to dst, which may be on
+// another Conn, and returns the jobs moved, in the order in which they
+// were visited. Each job is put in dst with its priority, TTR and, if
+// it is delayed, its remaining delay, and only then deleted from t.
+// Should a worker reserve the job in the meantime, so that it cannot be
+// deleted, the new job is deleted from dst instead and the job is left
+// in t. The move is therefore at least once: should that delete fail
+// too, the job is left in both tubes, but it is never lost.
+//
+// MoveTo never reserves the jobs in t, so they stay visible to workers
+// and their Attempts do not change. As beanstalkd only reveals the job
+// at the head of each state of a tube, MoveTo without a Filter takes
+// the jobs from the head one by one. With a Filter, it first scans for
+// the jobs in the state by asking for the statistics of each job id in
+// turn, from the newest down, at a round trip per id, and then visits
+// the jobs found in the order in which the server would hand them out.
+// The scan stops once it has found as many jobs as the tube statistics
+// count, or after opts.MaxScan ids, in which case MoveTo goes on with
+// the jobs found and then returns ErrScanIncomplete. Jobs whose ids are
+// above the number of jobs put, as on a server restored from its
+// binlog, may also be missed, in which case it returns ErrScanIncomplete
+// as well.
+func (t *Tube) MoveTo(dst *Tube, opts MoveOptions) ([]Moved, error) {
+	return t.MoveToContext(context.Background(), dst, opts)
+}
+
+// MoveToContext is like MoveTo, but takes a context.
+func (t *Tube) MoveToContext(ctx context.Context, dst *Tube, opts MoveOptions) ([]Moved, error) {
+	return t.relocate(ctx, dst, opts, true)
+}
+
+// CopyTo is like MoveTo, but leaves the original jobs in t. A body that
+// a ClaimCheck of t.Conn stored in a BlobStore is read back and put
+// through the Transformers of dst.Conn, so that the copy does not share
+// the blob of the original.
+func (t *Tube) CopyTo(dst *Tube, opts MoveOptions) ([]Moved, error) {
+	return t.CopyToContext(context.Background(), dst, opts)
+}
+
+// CopyToContext is like CopyTo, but takes a context.
+func (t *Tube) CopyToContext(ctx context.Context, dst *Tube, opts MoveOptions) ([]Moved, error) {
+	return t.relocate(ctx, dst, opts, false)
+}
+
+func (t *Tube) relocate(ctx context.Context, dst *Tube, opts MoveOptions, move bool) (moved []Moved, err error) {
+	if opts.State == "" {
+		opts.State = "buried"
+	}
+	peek := t.rawPeek(opts.State)
+	if peek == nil {
+		return nil, fmt.Errorf("beanstalk: cannot move jobs in state %q", opts.State)
+	}
+	if move && opts.Filter == nil && !opts.DryRun {
+		return t.moveHeads(ctx, dst, peek, opts)
+	}
+
+	found, scanErr := t.scan(ctx, peek, opts)
+	if scanErr != nil && scanErr != ErrScanIncomplete {
+		return nil, scanErr
+	}
+	for _, stats := range found {
+		if opts.Limit > 0 && len(moved) >= opts.Limit {
+			break
+		}
+		id := stats.Id
+		var body []byte
+		var err error
+		if opts.Filter != nil || !opts.DryRun {
+			err = t.Conn.idempotent(func() (err error) {
+				body, err = t.Conn.peek(ctx, id)
+				return err
+			})
+		}
+		if err == nil && !opts.DryRun {
+			// The statistics from the scan may be stale by now.
+			stats, err = t.Conn.StatsJobContext(ctx, id)
+		}
+		if e, ok := err.(ConnError); ok && e.Err == ErrNotFound {
+			continue // deleted since
+		} else if err != nil {
+			return moved, err
+		}
+		if stats.Tube != t.Name || stats.State != opts.State {
+			continue
+		}
+		if opts.Filter != nil {
+			h, payload, err := t.Conn.decodeJob(ctx, id, body)
+			if err != nil {
+				return moved, err
+			}
+			j := &Job{Id: id, Body: payload, Header: h, Tube: t.Name, Conn: t.Conn}
+			if !opts.Filter(j, stats) {
+				continue
+			}
+		}
+		m := Moved{Id: id, Stats: stats}
+		if !opts.DryRun {
+			var ok bool
+			if m.NewId, ok, err = t.relocateJob(ctx, dst, id, body, stats, move); err != nil {
+				return moved, err
+			} else if !ok {
+				continue
+			}
+		}
+		moved = append(moved, m)
+	}
+	return moved, scanErr
+}
+
+// moveHeads moves the jobs at the head of the state peeked by peek one
+// at a time, for MoveTo without a Filter.
+func (t *Tube) moveHeads(ctx context.Context, dst *Tube, peek func(context.Context) (uint64, []byte, error), opts MoveOptions) (moved []Moved, err error) {
+	for opts.Limit <= 0 || len(moved) < opts.Limit {
+		id, body, err := peek(ctx)
+		if e, ok := err.(ConnError); ok && e.Err == ErrNotFound {
+			return moved, nil
+		} else if err != nil {
+			return moved, err
+		}
+		stats, err := t.Conn.StatsJobContext(ctx, id)
+		if e, ok := err.(ConnError); ok && e.Err == ErrNotFound {
+			continue // the job changed under us; look again
+		} else if err != nil {
+			return moved, err
+		}
+		newId, ok, err := t.relocateJob(ctx, dst, id, body, stats, true)
+		if err != nil {
+			return moved, err
+		} else if !ok {
+			continue
+		}
+		moved = append(moved, Moved{Id: id, NewId: newId, Stats: stats})
+	}
+	return moved, nil
+}
+
+// relocateJob puts the job with the given id and body as stored, as
+// described by stats, in dst and, if move is set, deletes it from t. It
+// reports false if the job could not be deleted because it was reserved
+// or deleted in the meantime, in which case the new job is deleted
+// again.
+func (t *Tube) relocateJob(ctx context.Context, dst *Tube, id uint64, body []byte, stats JobStats, move bool) (newId uint64, ok bool, err error) {
+	var delay time.Duration
+	if stats.State == "delayed" {
+		delay = time.Duration(stats.TimeLeft) * time.Second
+	}
+	ttr := time.Duration(stats.Ttr) * time.Second
+	if !move && t.Conn.claimsOf(ctx, body) != nil {
+		// A copy of a claim-check body would share its blob with the
+		// original, and deleting either job would delete the blob of
+		// the other, so have the ClaimCheck of dst store a new one.
+		var h Header
+		var payload []byte
+		if h, payload, err = t.Conn.decodeJob(ctx, id, body); err == nil {
+			newId, err = dst.put(ctx, h, payload, uint32(stats.Pri), delay, ttr)
+		}
+	} else {
+		// The body is copied as stored, so that envelopes survive.
+		newId, err = dst.putRaw(ctx, body, uint32(stats.Pri), delay, ttr)
+	}
+	if err != nil || !move {
+		return newId, err == nil, err
+	}
+	err = t.Conn.DeleteContext(ctx, id)
+	if e, ok := err.(ConnError); ok && e.Err == ErrNotFound {
+		// The job was taken by a worker, so take back the new one. As
+		// dst.Conn has not reserved it, a blob it shares with the job
+		// is left alone.
+		return 0, false, dst.Conn.DeleteContext(ctx, newId)
+	}
+	return newId, err == nil, err
+}
+
+// scan lists the jobs in t in the state peeked by peek, using only
+// peek, stats, stats-tube and stats-job, in the order in which the
+// server would hand them out as far as their statistics tell. See
+// Tube.MoveTo.
+func (t *Tube) scan(ctx context.Context, peek func(context.Context) (uint64, []byte, error), opts MoveOptions) ([]JobStats, error) {
+	head, _, err := peek(ctx)
+	if e, ok := err.(ConnError); ok && e.Err == ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	ts, err := t.StatsContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	want := ts.CurrentJobsBuried
+	switch opts.State {
+	case "ready":
+		want = ts.CurrentJobsReady
+	case "delayed":
+		want = ts.CurrentJobsDelayed
+	}
+	// Ids are handed out in sequence, so the newest job has an id of
+	// at most the number of jobs put, unless the server was restarted
+	// from its binlog, and at least that of the head.
+	ss, err := t.Conn.StatsContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	top := ss.TotalJobs
+	if top < head {
+		top = head
+	}
+	max := uint64(opts.MaxScan)
+	if max == 0 {
+		max = DefaultMaxScan
+	}
+
+	var found []JobStats
+	for id := top; id > 0 && top-id < max && uint64(len(found)) < want; id-- {
+		stats, err := t.Conn.StatsJobContext(ctx, id)
+		if e, ok := err.(ConnError); ok && e.Err == ErrNotFound {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if stats.Tube == t.Name && stats.State == opts.State {
+			found = append(found, stats)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool {
+		a, b := found[i], found[j]
+		switch {
+		case opts.State == "ready" && a.Pri != b.Pri:
+			return a.Pri < b.Pri
+		case opts.State == "delayed" && a.TimeLeft != b.TimeLeft:
+			return a.TimeLeft < b.TimeLeft
+		}
+		return a.Id < b.Id
+	})
+	if uint64(len(found)) < want {
+		return found, ErrScanIncomplete
+	}
+	return found, nil
+}
@@ -0,0 +1,193 @@
+package beanstalk
+
+import (
+	"io"
+	"testing"
+)
+
+// putBuried puts a buried job into tube on s.
+func putBuried(s *mockServer, tube, body string, pri uint64) uint64 {
+	id := s.put(tube, []byte(body), pri, 0, 60)
+	s.mu.Lock()
+	s.jobs[id].state = "buried"
+	s.mu.Unlock()
+	return id
+}
+
+func TestMoveTo(t *testing.T) {
+	s := newMockServer()
+	c := s.Conn()
+	defer c.Close()
+	putBuried(s, "a", "x", 5)
+	keep := putBuried(s, "a", "keep", 6)
+	putBuried(s, "a", "y", 7)
+
+	moved, err := (&Tube{c, "a"}).MoveTo(&Tube{c, "b"}, MoveOptions{
+		Filter: func(j *Job, stats JobStats) bool { return string(j.Body) != "keep" },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(moved) != 2 {
+		t.Fatal("expected 2 jobs moved, got", len(moved))
+	}
+	for _, m := range moved {
+		if s.job(m.Id) != nil {
+			t.Fatal("expected original job to be deleted")
+		}
+		j := s.job(m.NewId)
+		if j == nil || j.tube != "b" || j.state != "ready" || j.pri != m.Stats.Pri || j.ttr != 60 {
+			t.Fatalf("got %+v", j)
+		}
+	}
+	if j := s.job(keep); j.state != "buried" || j.pri != 6 || j.reserves != 0 {
+		t.Fatalf("expected unmoved job to stay buried, got %+v", j)
+	}
+}
+
+func TestMoveToReservedMeanwhile(t *testing.T) {
+	s := newMockServer()
+	c := s.Conn()
+	defer c.Close()
+	id := s.put("a", []byte("x"), 5, 0, 60)
+
+	var worker struct{ io.ReadWriteCloser }
+	moved, err := (&Tube{c, "a"}).MoveTo(&Tube{c, "b"}, MoveOptions{
+		State: "ready",
+		Filter: func(j *Job, stats JobStats) bool {
+			s.reserve(nil, j.Id, worker) // a worker takes the job
+			return true
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(moved) != 0 {
+		t.Fatalf("got %+v", moved)
+	}
+	if j := s.job(id); j == nil || j.state != "reserved" {
+		t.Fatalf("expected job to stay with the worker, got %+v", j)
+	}
+	if s.count("b", "ready") != 0 {
+		t.Fatal("expected the new job to be deleted again")
+	}
+}
+
+func TestMoveToScanIncomplete(t *testing.T) {
+	s := newMockServer()
+	c := s.Conn()
+	defer c.Close()
+	for i := 0; i < 5; i++ {
+		putBuried(s, "a", "x", 0)
+	}
+
+	moved, err := (&Tube{c, "a"}).CopyTo(&Tube{c, "b"}, MoveOptions{MaxScan: 2})
+	if err != ErrScanIncomplete {
+		t.Fatal("expected ErrScanIncomplete, got", err)
+	}
+	if len(moved) != 2 || moved[0].Id != 4 || moved[1].Id != 5 {
+		t.Fatalf("got %+v", moved)
+	}
+	if s.count("b", "ready") != 2 || s.count("a", "buried") != 5 {
+		t.Fatal("expected the jobs found to be copied")
+	}
+}
+
+func TestMoveToDelayed(t *testing.T) {
+	s := newMockServer()
+	c := s.Conn()
+	defer c.Close()
+	s.put("a", []byte("x"), 3, 30, 60)
+
+	moved, err := (&Tube{c, "a"}).MoveTo(&Tube{c, "b"}, MoveOptions{State: "delayed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(moved) != 1 {
+		t.Fatal("expected 1 job moved, got", len(moved))
+	}
+	if j := s.job(moved[0].NewId); j.state != "delayed" || j.delay != 30 || j.pri != 3 {
+		t.Fatalf("got %+v", j)
+	}
+}
+
+func TestCopyTo(t *testing.T) {
+	s := newMockServer()
+	c := s.Conn()
+	defer c.Close()
+	id1 := putBuried(s, "a", "x", 5)
+	id2 := putBuried(s, "a", "y", 5)
+
+	moved, err := (&Tube{c, "a"}).CopyTo(&Tube{c, "b"}, MoveOptions{Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(moved) != 1 || moved[0].Id != id1 {
+		t.Fatalf("got %+v", moved)
+	}
+	if j := s.job(id1); j.state != "buried" || j.reserves != 0 {
+		t.Fatal("expected originals to stay buried")
+	}
+	if s.job(id2).state != "buried" {
+		t.Fatal("expected originals to stay buried")
+	}
+	if s.count("b", "ready") != 1 {
+		t.Fatal("expected copy in b")
+	}
+}
+
+func TestMoveToDryRun(t *testing.T) {
+	s := newMockServer()
+	c := s.Conn()
+	defer c.Close()
+	id := s.put("a", []byte("x"), 5, 0, 60)
+
+	moved, err := (&Tube{c, "a"}).MoveTo(&Tube{c, "b"}, MoveOptions{State: "ready", DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(moved) != 1 || moved[0].Id != id || moved[0].NewId != 0 || moved[0].Stats.Pri != 5 {
+		t.Fatalf("got %+v", moved)
+	}
+	if j := s.job(id); j.state != "ready" || j.pri != 5 || j.reserves != 0 || j.releases != 0 {
+		t.Fatalf("expected job to be left alone, got %+v", j)
+	}
+	if s.count("b", "ready") != 0 {
+		t.Fatal("expected nothing put in dry run")
+	}
+}
+
+func TestMoveToDryRunOrder(t *testing.T) {
+	s := newMockServer()
+	c := s.Conn()
+	defer c.Close()
+	s.put("a", []byte("x"), 9, 0, 60)
+	skip := s.put("a", []byte("skip"), 1, 0, 60)
+	s.put("b", []byte("x"), 0, 0, 60)
+	urgent := s.put("a", []byte("x"), 2, 0, 60)
+	s.put("a", []byte("x"), 5, 0, 60)
+	putBuried(s, "a", "x", 0)
+
+	moved, err := (&Tube{c, "a"}).MoveTo(&Tube{c, "c"}, MoveOptions{
+		State:  "ready",
+		Filter: func(j *Job, stats JobStats) bool { return string(j.Body) != "skip" },
+		Limit:  2,
+		DryRun: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(moved) != 2 || moved[0].Id != urgent || moved[1].Stats.Pri != 5 {
+		t.Fatalf("got %+v", moved)
+	}
+	if j := s.job(skip); j.reserves != 0 {
+		t.Fatalf("expected job not to be reserved, got %+v", j)
+	}
+}
+
+func TestMoveToBadState(t *testing.T) {
+	c := NewConn(mock("", ""))
+	if _, err := (&Tube{c, "a"}).MoveTo(&Tube{c, "b"}, MoveOptions{State: "reserved"}); err == nil {
+		t.Fatal("expected error")
+	}
+}
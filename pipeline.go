@@ -0,0 +1,203 @@
+package beanstalk
+
+import (
+	"context"
+	"sync"
+)
+
+// A pipeline manages a pipelined in-order request/response sequence.
+// Each command on a Conn is assigned an id by Next; its request is
+// written between StartRequestContext and EndRequest, and its response is
+// read between StartResponse and EndResponse. Requests and responses
+// happen strictly in id order, so a single Conn can be shared by
+// many goroutines.
+//
+// It is modeled on textproto.Pipeline, but a command that failed
+// before reaching the server can give up its response slot with
+// SkipResponse without waiting for earlier responses to be read.
+type pipeline struct {
+	mu       sync.Mutex
+	id       uint
+	request  sequencer
+	response sequencer
+}
+
+// Next returns the next id for a request/response pair.
+func (p *pipeline) Next() uint {
+	p.mu.Lock()
+	id := p.id
+	p.id++
+	p.mu.Unlock()
+	return id
+}
+
+// StartRequestContext blocks until it is time to send the request with
+// the given id, or until ctx is done. In the latter case the request
+// and its response are skipped and ctx.Err() is returned.
+func (p *pipeline) StartRequestContext(ctx context.Context, id uint) error {
+	err := p.request.StartContext(ctx, id)
+	if err != nil {
+		p.request.Skip(id)
+		p.response.Skip(id)
+	}
+	return err
+}
+
+// EndRequest notifies p that the request with the given id has been sent.
+func (p *pipeline) EndRequest(id uint) {
+	p.request.End(id)
+}
+
+// StartResponse blocks until it is time to receive the response with
+// the given id.
+func (p *pipeline) StartResponse(id uint) {
+	p.response.Start(id)
+}
+
+// StartResponseContext is like StartResponse, but gives up waiting
+// when ctx is done and returns ctx.Err(). The response still arrives
+// from the server in its turn, so the caller remains responsible for
+// reading it eventually.
+func (p *pipeline) StartResponseContext(ctx context.Context, id uint) error {
+	return p.response.StartContext(ctx, id)
+}
+
+// EndResponse notifies p that the response with the given id has been
+// received.
+func (p *pipeline) EndResponse(id uint) {
+	p.response.End(id)
+}
+
+// HandOffResponse notifies p that the response with the given id,
+// whose turn has come, has been handed to another goroutine: the next
+// EndResponse for it, from the goroutine that gave it up, is ignored,
+// and the one after that ends it.
+func (p *pipeline) HandOffResponse(id uint) {
+	p.response.HandOff(id)
+}
+
+// SkipResponse notifies p that no response will be read for the given
+// id, because its request never reached the server.
+func (p *pipeline) SkipResponse(id uint) {
+	p.response.Skip(id)
+}
+
+// A sequencer schedules a sequence of numbered events that must
+// happen in order, one after the other.
+type sequencer struct {
+	mu      sync.Mutex
+	id      uint
+	wait    map[uint]chan struct{}
+	skip    map[uint]bool
+	handOff bool // the next End of the current event is ignored
+}
+
+// Start waits until it is time for the event numbered id to begin.
+// That is, except for the first event, it waits until End(id-1) has
+// been called or id-1 has been skipped.
+func (s *sequencer) Start(id uint) {
+	s.mu.Lock()
+	if s.id == id {
+		s.mu.Unlock()
+		return
+	}
+	c := make(chan struct{})
+	if s.wait == nil {
+		s.wait = make(map[uint]chan struct{})
+	}
+	s.wait[id] = c
+	s.mu.Unlock()
+	<-c
+}
+
+// StartContext is like Start, but gives up waiting when ctx is done
+// and returns ctx.Err(). The event is then neither started nor
+// completed; the caller must Skip it or Start it again later.
+func (s *sequencer) StartContext(ctx context.Context, id uint) error {
+	done := ctx.Done()
+	if done == nil {
+		s.Start(id)
+		return nil
+	}
+	s.mu.Lock()
+	if s.id == id {
+		s.mu.Unlock()
+		return nil
+	}
+	c := make(chan struct{})
+	if s.wait == nil {
+		s.wait = make(map[uint]chan struct{})
+	}
+	s.wait[id] = c
+	s.mu.Unlock()
+
+	select {
+	case <-c:
+		return nil
+	case <-done:
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.id == id {
+		// Our turn came while ctx was being canceled. Take it anyway;
+		// the caller will notice ctx.Err() soon enough.
+		return nil
+	}
+	delete(s.wait, id)
+	return ctx.Err()
+}
+
+// End notifies the sequencer that the event numbered id has completed,
+// allowing it to schedule the event numbered id+1. It is a run-time
+// error to call End with an id that is not the current event.
+func (s *sequencer) End(id uint) {
+	s.mu.Lock()
+	if s.id != id {
+		s.mu.Unlock()
+		panic("beanstalk: internal error: sequencer out of sync")
+	}
+	if s.handOff {
+		s.handOff = false
+	} else {
+		s.advance()
+	}
+	s.mu.Unlock()
+}
+
+// HandOff makes the next End of the current event, numbered id, a
+// no-op, so that the event can be completed by another End.
+func (s *sequencer) HandOff(id uint) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.id != id {
+		panic("beanstalk: internal error: sequencer out of sync")
+	}
+	s.handOff = true
+}
+
+// Skip marks the event numbered id as completed without waiting for
+// it to begin. Nobody may call Start for id after it has been skipped.
+func (s *sequencer) Skip(id uint) {
+	s.mu.Lock()
+	if s.id == id {
+		s.advance()
+	} else {
+		if s.skip == nil {
+			s.skip = make(map[uint]bool)
+		}
+		s.skip[id] = true
+	}
+	s.mu.Unlock()
+}
+
+func (s *sequencer) advance() {
+	s.id++
+	for s.skip[s.id] {
+		delete(s.skip, s.id)
+		s.id++
+	}
+	if c, ok := s.wait[s.id]; ok {
+		delete(s.wait, s.id)
+		close(c)
+	}
+}
@@ -0,0 +1,69 @@
+package beanstalk
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSequencerOrder(t *testing.T) {
+	var s sequencer
+	done := make(chan uint, 3)
+	for _, id := range []uint{2, 1, 0} {
+		go func(id uint) {
+			s.Start(id)
+			done <- id
+			s.End(id)
+		}(id)
+	}
+	for exp := uint(0); exp < 3; exp++ {
+		if got := <-done; got != exp {
+			t.Fatalf("expected %d, got %d", exp, got)
+		}
+	}
+}
+
+func TestSequencerSkip(t *testing.T) {
+	var s sequencer
+	s.Skip(1)
+	started := make(chan struct{})
+	go func() {
+		s.Start(2)
+		close(started)
+	}()
+	select {
+	case <-started:
+		t.Fatal("started 2 before 0 ended")
+	case <-time.After(10 * time.Millisecond):
+	}
+	s.Start(0)
+	s.End(0)
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("2 did not start after 0 ended and 1 was skipped")
+	}
+	s.End(2)
+}
+
+func TestSequencerSkipCurrent(t *testing.T) {
+	var s sequencer
+	s.Skip(0)
+	s.Start(1)
+	s.End(1)
+}
+
+func TestSequencerStartContext(t *testing.T) {
+	var s sequencer
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := s.StartContext(ctx, 1); err != context.Canceled {
+		t.Fatal("expected context.Canceled, got", err)
+	}
+	if err := s.StartContext(ctx, 0); err != nil {
+		t.Fatal("current event should start regardless of ctx, got", err)
+	}
+	s.End(0)
+	s.Start(1)
+	s.End(1)
+}
@@ -0,0 +1,254 @@
+package beanstalk
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// DefaultMaxIdle is the default maximum number of idle Conns kept by a Pool.
+const DefaultMaxIdle = 2
+
+// Pool errors.
+var (
+	ErrPoolClosed    = errors.New("pool closed")
+	ErrPoolExhausted = errors.New("pool exhausted")
+)
+
+// A Pool manages a set of Conns to a single beanstalkd server and hands
+// them out for producer and consumer work. A Conn is taken from the
+// Pool with Checkout and given back with Checkin. Conns that failed
+// with an I/O error are closed rather than reused.
+//
+// The configuration fields must not be changed after the Pool is first
+// used. A Pool is safe for concurrent use by multiple goroutines.
+type Pool struct {
+	// Dial opens a new Conn to the server.
+	Dial func(ctx context.Context) (*Conn, error)
+
+	// MaxOpen is the maximum number of Conns open at once, checked out
+	// or idle. If it is zero there is no limit. When the limit is
+	// reached, Checkout blocks until a Conn is checked in.
+	MaxOpen int
+
+	// MaxIdle is the maximum number of idle Conns kept for reuse.
+	// If it is zero, DefaultMaxIdle is used; if it is negative, no
+	// idle Conns are kept.
+	MaxIdle int
+
+	// WaitTimeout bounds how long Checkout blocks when MaxOpen Conns
+	// are already checked out. If it is zero, Checkout waits until its
+	// context is done.
+	WaitTimeout time.Duration
+
+	// CheckInterval is how often idle Conns are validated with a cheap
+	// command; those that fail are closed. A Conn that has been idle
+	// for longer than CheckInterval is also validated before Checkout
+	// hands it out. If it is zero, idle Conns are never validated.
+	CheckInterval time.Duration
+
+	mu      sync.Mutex
+	idle    []idleConn
+	open    int
+	closed  bool
+	changed chan struct{} // closed and replaced whenever open or idle shrinks
+	stop    chan struct{} // closed by Close to stop the health checker
+}
+
+type idleConn struct {
+	c     *Conn
+	since time.Time
+}
+
+// NewPool returns a new Pool of Conns to addr on the given network,
+// dialed with a timeout of DefaultDialTimeout.
+func NewPool(network, addr string) *Pool {
+	return &Pool{
+		Dial: func(ctx context.Context) (*Conn, error) {
+			return dialContext(ctx, network, addr, DefaultDialTimeout)
+		},
+	}
+}
+
+// Checkout returns an idle Conn from p, or dials a new one.
+func (p *Pool) Checkout() (*Conn, error) {
+	return p.CheckoutContext(context.Background())
+}
+
+// CheckoutContext is like Checkout, but takes a context.
+func (p *Pool) CheckoutContext(ctx context.Context) (*Conn, error) {
+	var timeout <-chan time.Time
+	if p.WaitTimeout > 0 {
+		t := time.NewTimer(p.WaitTimeout)
+		defer t.Stop()
+		timeout = t.C
+	}
+	for {
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			return nil, ErrPoolClosed
+		}
+		p.startChecker()
+		if n := len(p.idle); n > 0 {
+			ic := p.idle[n-1]
+			p.idle = p.idle[:n-1]
+			p.mu.Unlock()
+			if p.CheckInterval > 0 && time.Since(ic.since) > p.CheckInterval && !p.healthy(ctx, ic.c) {
+				p.discard(ic.c)
+				continue
+			}
+			return ic.c, nil
+		}
+		if p.MaxOpen <= 0 || p.open < p.MaxOpen {
+			p.open++
+			p.mu.Unlock()
+			c, err := p.Dial(ctx)
+			if err != nil {
+				p.mu.Lock()
+				p.open--
+				p.notify()
+				p.mu.Unlock()
+				return nil, err
+			}
+			return c, nil
+		}
+		if p.changed == nil {
+			p.changed = make(chan struct{})
+		}
+		changed := p.changed
+		p.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-timeout:
+			return nil, ErrPoolExhausted
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Checkin returns c, which must have been obtained from Checkout, to p.
+// Err is the last error returned by a command on c, if any; if it shows
+// that the connection failed, c is closed instead of being reused.
+func (p *Pool) Checkin(c *Conn, err error) {
+	if !c.usable() || isIOError(err) {
+		p.discard(c)
+		return
+	}
+	p.mu.Lock()
+	if p.closed || len(p.idle) >= p.maxIdle() {
+		p.mu.Unlock()
+		p.discard(c)
+		return
+	}
+	p.idle = append(p.idle, idleConn{c, time.Now()})
+	p.notify()
+	p.mu.Unlock()
+}
+
+// Close closes all idle Conns and stops p from handing out more.
+// Conns that are checked out are closed when they are checked in.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	idle := p.idle
+	p.idle = nil
+	p.open -= len(idle)
+	if p.stop != nil {
+		close(p.stop)
+	}
+	p.notify()
+	p.mu.Unlock()
+
+	var err error
+	for _, ic := range idle {
+		if e := ic.c.Close(); err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+func (p *Pool) maxIdle() int {
+	switch {
+	case p.MaxIdle == 0:
+		return DefaultMaxIdle
+	case p.MaxIdle < 0:
+		return 0
+	}
+	return p.MaxIdle
+}
+
+// discard closes c, which is no longer idle or checked out.
+func (p *Pool) discard(c *Conn) {
+	c.Close()
+	p.mu.Lock()
+	p.open--
+	p.notify()
+	p.mu.Unlock()
+}
+
+// notify wakes up goroutines waiting in Checkout. p.mu must be held.
+func (p *Pool) notify() {
+	if p.changed != nil {
+		close(p.changed)
+		p.changed = nil
+	}
+}
+
+// healthy validates c with a cheap command.
+func (p *Pool) healthy(ctx context.Context, c *Conn) bool {
+	ctx, cancel := context.WithTimeout(ctx, DefaultDialTimeout)
+	defer cancel()
+	_, err := c.ListTubeUsedContext(ctx)
+	return err == nil
+}
+
+// startChecker starts the goroutine validating idle Conns, if it is
+// needed and not yet running. p.mu must be held.
+func (p *Pool) startChecker() {
+	if p.CheckInterval <= 0 || p.stop != nil {
+		return
+	}
+	p.stop = make(chan struct{})
+	go p.checkIdle(p.CheckInterval, p.stop)
+}
+
+func (p *Pool) checkIdle(interval time.Duration, stop chan struct{}) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+		}
+		p.mu.Lock()
+		var stale []idleConn
+		fresh := p.idle[:0]
+		for _, ic := range p.idle {
+			if time.Since(ic.since) >= interval {
+				stale = append(stale, ic)
+			} else {
+				fresh = append(fresh, ic)
+			}
+		}
+		p.idle = fresh
+		p.mu.Unlock()
+
+		for _, ic := range stale {
+			if p.healthy(context.Background(), ic.c) {
+				p.Checkin(ic.c, nil)
+			} else {
+				p.discard(ic.c)
+			}
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package beanstalk
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestPoolReuse(t *testing.T) {
+	s := newMockServer()
+	p := &Pool{Dial: s.Dial}
+	defer p.Close()
+
+	c1, err := p.Checkout()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Checkin(c1, nil)
+	c2, err := p.Checkout()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c1 != c2 {
+		t.Fatal("expected idle Conn to be reused")
+	}
+	p.Checkin(c2, nil)
+	if s.dials != 1 {
+		t.Fatal("expected 1 dial, got", s.dials)
+	}
+}
+
+func TestPoolDiscardsBrokenConn(t *testing.T) {
+	s := newMockServer()
+	p := &Pool{Dial: s.Dial}
+	defer p.Close()
+
+	c1, err := p.Checkout()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c1.Peek(1)
+	p.Checkin(c1, err) // NOT_FOUND leaves the Conn usable
+	c2, err := p.Checkout()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c1 != c2 {
+		t.Fatal("expected Conn with server error to be reused")
+	}
+
+	p.Checkin(c2, ConnError{c2, "peek", io.EOF})
+	c3, err := p.Checkout()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c3 == c2 {
+		t.Fatal("expected Conn with I/O error to be discarded")
+	}
+	p.Checkin(c3, nil)
+}
+
+func TestPoolMaxOpen(t *testing.T) {
+	s := newMockServer()
+	p := &Pool{Dial: s.Dial, MaxOpen: 1, WaitTimeout: 20 * time.Millisecond}
+	defer p.Close()
+
+	c, err := p.Checkout()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = p.Checkout(); err != ErrPoolExhausted {
+		t.Fatal("expected ErrPoolExhausted, got", err)
+	}
+
+	got := make(chan *Conn)
+	go func() {
+		c, err := p.CheckoutContext(context.Background())
+		if err != nil {
+			t.Error(err)
+		}
+		got <- c
+	}()
+	time.Sleep(5 * time.Millisecond)
+	p.Checkin(c, nil)
+	if c2 := <-got; c2 != c {
+		t.Fatal("expected waiting Checkout to get the checked in Conn")
+	}
+}
+
+func TestPoolMaxIdle(t *testing.T) {
+	s := newMockServer()
+	p := &Pool{Dial: s.Dial, MaxIdle: 1}
+	defer p.Close()
+
+	c1, _ := p.Checkout()
+	c2, _ := p.Checkout()
+	p.Checkin(c1, nil)
+	p.Checkin(c2, nil)
+	if len(p.idle) != 1 || p.open != 1 {
+		t.Fatalf("expected 1 idle and 1 open, got %d and %d", len(p.idle), p.open)
+	}
+	if _, err := c2.ListTubeUsed(); err == nil {
+		t.Fatal("expected Conn beyond MaxIdle to be closed")
+	}
+}
+
+func TestPoolHealthCheck(t *testing.T) {
+	s := newMockServer()
+	p := &Pool{Dial: s.Dial, CheckInterval: 10 * time.Millisecond}
+	defer p.Close()
+
+	c1, _ := p.Checkout()
+	p.Checkin(c1, nil)
+	s.disconnect()
+	time.Sleep(50 * time.Millisecond)
+
+	c2, err := p.Checkout()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c2 == c1 {
+		t.Fatal("expected dead idle Conn to be discarded")
+	}
+	if _, err = c2.ListTubeUsed(); err != nil {
+		t.Fatal(err)
+	}
+	p.Checkin(c2, nil)
+}
+
+func TestPoolClose(t *testing.T) {
+	s := newMockServer()
+	p := &Pool{Dial: s.Dial}
+	c, _ := p.Checkout()
+	p.Checkin(c, nil)
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Checkout(); err != ErrPoolClosed {
+		t.Fatal("expected ErrPoolClosed, got", err)
+	}
+}
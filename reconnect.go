@@ -0,0 +1,200 @@
+package beanstalk
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// Default backoff between attempts of a reconnecting Conn to redial.
+const (
+	DefaultMinBackoff = 100 * time.Millisecond
+	DefaultMaxBackoff = 30 * time.Second
+)
+
+// maxRetries bounds how many times an idempotent command is resent
+// after its connection was reset.
+const maxRetries = 3
+
+// A ReconnectPolicy describes how a reconnecting Conn opens its
+// connection and how it reopens it after a failure.
+//
+// When the connection of a reconnecting Conn fails, the next command
+// redials, waiting with exponential backoff between attempts, and
+// re-applies the tube in use and the full watch list before it is
+// sent. Commands that only read server state (stats, peek and the
+// list commands) are retried transparently if their connection fails
+// under them. Other commands in flight at the time, such as put or
+// reserve, fail with a ConnError recording ErrConnReset, since they
+// may or may not have taken effect.
+type ReconnectPolicy struct {
+	// Dial opens a new connection to the server.
+	Dial func(ctx context.Context) (io.ReadWriteCloser, error)
+
+	// MinBackoff and MaxBackoff bound the exponential backoff between
+	// dial attempts. If they are zero, DefaultMinBackoff and
+	// DefaultMaxBackoff are used.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// MaxAttempts is how many times a command tries to dial before it
+	// fails with the dial error. If it is zero, the command keeps
+	// trying until its context is done.
+	MaxAttempts int
+}
+
+// NewReconnectingConn dials a new connection with p.Dial and returns
+// a Conn that reconnects automatically according to p.
+func NewReconnectingConn(p ReconnectPolicy) (*Conn, error) {
+	return NewReconnectingConnContext(context.Background(), p)
+}
+
+// NewReconnectingConnContext is like NewReconnectingConn, but takes a
+// context for the initial dial.
+func NewReconnectingConnContext(ctx context.Context, p ReconnectPolicy) (*Conn, error) {
+	rwc, err := p.Dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c := NewConn(rwc)
+	c.reconnect = &p
+	return c, nil
+}
+
+// DialReconnect is like Dial, but returns a Conn that reconnects
+// automatically with the default backoff when its connection fails.
+func DialReconnect(network, addr string) (*Conn, error) {
+	dialer := &net.Dialer{
+		Timeout:   DefaultDialTimeout,
+		KeepAlive: DefaultKeepAlivePeriod,
+	}
+	return NewReconnectingConn(ReconnectPolicy{
+		Dial: func(ctx context.Context) (io.ReadWriteCloser, error) {
+			return dialer.DialContext(ctx, network, addr)
+		},
+	})
+}
+
+// redial replaces the failed connection of c, which must hold the
+// request turn for r. It waits for every earlier command to finish,
+// then dials according to c.reconnect until it succeeds or gives up.
+func (c *Conn) redial(ctx context.Context, r req) error {
+	// Wake up any reader still blocked on the dead connection.
+	c.c.Close()
+	err := c.p.StartResponseContext(ctx, r.id)
+	if err != nil {
+		return err
+	}
+	// Nothing else is in flight now; the caller still holds the
+	// response turn for r.id and uses it to read its own response.
+	p := c.reconnect
+	backoff, maxBackoff := p.MinBackoff, p.MaxBackoff
+	if backoff <= 0 {
+		backoff = DefaultMinBackoff
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = DefaultMaxBackoff
+	}
+	for attempt := 1; ; attempt++ {
+		err = c.replace(ctx)
+		if err == nil {
+			atomic.StoreInt32(&c.unusable, 0)
+			return nil
+		}
+		if err == net.ErrClosed || p.MaxAttempts > 0 && attempt >= p.MaxAttempts {
+			return err
+		}
+		t := time.NewTimer(backoff)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// replace dials a new connection for c and re-applies the tube in use
+// and the watch list to it.
+func (c *Conn) replace(ctx context.Context) error {
+	c.mu.Lock()
+	closed := c.closed
+	c.mu.Unlock()
+	if closed {
+		return net.ErrClosed
+	}
+	rwc, err := c.reconnect.Dial(ctx)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		rwc.Close()
+		return net.ErrClosed
+	}
+	c.c = rwc
+	c.mu.Unlock()
+	c.w.Reset(rwc)
+	c.r.Reset(rwc)
+
+	n := 0
+	if c.used != "default" {
+		c.printLine("use", c.used)
+		n++
+	}
+	for s := range c.watched {
+		if s != "default" {
+			c.printLine("watch", s)
+			n++
+		}
+	}
+	if !c.watched["default"] {
+		c.printLine("ignore", "default")
+		n++
+	}
+	err = c.replay(ctx, n)
+	if err != nil {
+		rwc.Close()
+	}
+	return err
+}
+
+func (c *Conn) replay(ctx context.Context, n int) error {
+	stop := c.watchWrite(ctx)
+	err := c.w.Flush()
+	stop()
+	if err != nil {
+		return err
+	}
+	stop = c.watchRead(ctx, 0)
+	defer stop()
+	for i := 0; i < n; i++ {
+		line, err := c.readLine()
+		if err != nil {
+			return err
+		}
+		if err = c.scan(line, "USING ", nil); err != nil {
+			if err = c.scan(line, "WATCHING ", nil); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// idempotent calls f, which runs a command that is safe to repeat, and
+// calls it again if it failed only because its connection was reset.
+func (c *Conn) idempotent(f func() error) error {
+	err := f()
+	for i := 0; i < maxRetries && errors.Is(err, ErrConnReset); i++ {
+		err = f()
+	}
+	return err
+}
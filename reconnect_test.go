@@ -0,0 +1,118 @@
+package beanstalk
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReconnectReplaysTubes(t *testing.T) {
+	s := newMockServer()
+	c, err := NewReconnectingConn(ReconnectPolicy{Dial: s.DialRaw})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	foo := &Tube{c, "foo"}
+	if _, err = foo.Put([]byte("a"), 0, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	ts := NewTubeSet(c, "foo", "bar")
+	if _, _, err = ts.Reserve(0); err != nil {
+		t.Fatal(err)
+	}
+
+	s.disconnect()
+
+	// Idempotent commands are retried on the new connection.
+	used, err := c.ListTubeUsed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if used != "foo" {
+		t.Fatalf("expected %#v, got %#v", "foo", used)
+	}
+	watched, err := c.ListTubesWatched()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(watched, []string{"bar", "foo"}) {
+		t.Fatalf("expected %#v, got %#v", []string{"bar", "foo"}, watched)
+	}
+	if s.dials != 2 {
+		t.Fatal("expected 2 dials, got", s.dials)
+	}
+}
+
+func TestReconnectResetsPut(t *testing.T) {
+	s := newMockServer()
+	c, err := NewReconnectingConn(ReconnectPolicy{Dial: s.DialRaw})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	s.disconnect()
+	_, err = c.Put([]byte("a"), 0, 0, 0)
+	if !errors.Is(err, ErrConnReset) {
+		t.Fatal("expected ErrConnReset, got", err)
+	}
+	if _, err = c.Put([]byte("a"), 0, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReconnectBackoff(t *testing.T) {
+	s := newMockServer()
+	var fails int
+	dial := func(ctx context.Context) (io.ReadWriteCloser, error) {
+		if fails > 0 {
+			fails--
+			return nil, errors.New("connection refused")
+		}
+		return s.DialRaw(ctx)
+	}
+	c, err := NewReconnectingConn(ReconnectPolicy{
+		Dial:        dial,
+		MinBackoff:  time.Millisecond,
+		MaxAttempts: 3,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	s.disconnect()
+	fails = 2
+	if _, err = c.ListTubeUsed(); err != nil {
+		t.Fatal(err)
+	}
+
+	s.disconnect()
+	fails = 5
+	if _, err = c.ListTubeUsed(); err == nil {
+		t.Fatal("expected dial error after MaxAttempts")
+	}
+	if _, err = c.ListTubeUsed(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReconnectClosed(t *testing.T) {
+	s := newMockServer()
+	c, err := NewReconnectingConn(ReconnectPolicy{Dial: s.DialRaw})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	if _, err = c.ListTubeUsed(); err == nil {
+		t.Fatal("expected error on closed Conn")
+	}
+	if s.dials != 1 {
+		t.Fatal("closed Conn redialed")
+	}
+}
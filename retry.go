@@ -0,0 +1,87 @@
+package beanstalk
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// A RetryPolicy decides what becomes of a job whose processing failed
+// with a retryable error.
+type RetryPolicy interface {
+	// Retry returns the delay with which to release the job, given
+	// its statistics from when it was reserved, or ok false if the job
+	// has had enough attempts and should be given up on.
+	Retry(stats JobStats) (delay time.Duration, ok bool)
+}
+
+// Attempts returns the number of times the job described by stats has
+// been tried, counting the current reservation. Every reservation
+// counts, whether it ended in a release or in the job's TTR running
+// out.
+func Attempts(stats JobStats) int {
+	if stats.Reserves == 0 {
+		return 1
+	}
+	return int(stats.Reserves)
+}
+
+// ExponentialBackoff is a RetryPolicy whose delay starts at MinDelay
+// and is multiplied by Factor after each attempt, up to MaxDelay.
+// The server counts delays in whole seconds, so each delay is rounded
+// up to one.
+type ExponentialBackoff struct {
+	MinDelay time.Duration
+	MaxDelay time.Duration // no limit if zero
+
+	// Factor is the growth of the delay per attempt. If it is zero,
+	// the delay doubles.
+	Factor float64
+
+	// Jitter is the fraction, from 0 to 1, by which each delay is
+	// randomly reduced, to spread out the retries of jobs that failed
+	// together. Values outside that range are taken as the nearest end.
+	Jitter float64
+
+	// MaxAttempts is the number of attempts after which the job is
+	// given up on. If it is zero, the job is retried indefinitely.
+	MaxAttempts int
+}
+
+// Retry implements RetryPolicy.
+func (b ExponentialBackoff) Retry(stats JobStats) (time.Duration, bool) {
+	n := Attempts(stats)
+	if b.MaxAttempts > 0 && n >= b.MaxAttempts {
+		return 0, false
+	}
+	f := b.Factor
+	if f == 0 {
+		f = 2
+	}
+	d := float64(b.MinDelay) * math.Pow(f, float64(n-1))
+	max := float64(b.MaxDelay)
+	if b.MaxDelay <= 0 {
+		max = 1 << 62 // keep clear of overflow
+	}
+	if d > max {
+		d = max
+	}
+	if j := math.Min(b.Jitter, 1); j > 0 {
+		d -= d * j * rand.Float64()
+	}
+	return time.Duration(math.Ceil(d/float64(time.Second))) * time.Second, true
+}
+
+// RetrySchedule is a RetryPolicy that releases a job after its nth
+// attempt with the nth delay in the schedule, and gives up on it once
+// the schedule is exhausted.
+type RetrySchedule []time.Duration
+
+// Retry implements RetryPolicy.
+func (s RetrySchedule) Retry(stats JobStats) (time.Duration, bool) {
+	n := Attempts(stats)
+	if n > len(s) {
+		return 0, false
+	}
+	return s[n-1], true
+}
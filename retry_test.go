@@ -0,0 +1,104 @@
+package beanstalk
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestExponentialBackoff(t *testing.T) {
+	b := ExponentialBackoff{MinDelay: time.Second, MaxDelay: 5 * time.Second, MaxAttempts: 5}
+	for _, tt := range []struct {
+		reserves uint64
+		want     time.Duration
+		ok       bool
+	}{
+		{0, time.Second, true},
+		{1, time.Second, true},
+		{2, 2 * time.Second, true},
+		{3, 4 * time.Second, true},
+		{4, 5 * time.Second, true},
+		{5, 0, false},
+	} {
+		d, ok := b.Retry(JobStats{Reserves: tt.reserves})
+		if d != tt.want || ok != tt.ok {
+			t.Errorf("reserves %d: got %v, %v, want %v, %v", tt.reserves, d, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestExponentialBackoffUncapped(t *testing.T) {
+	b := ExponentialBackoff{MinDelay: time.Second, Factor: 3}
+	if d, ok := b.Retry(JobStats{Reserves: 3}); d != 9*time.Second || !ok {
+		t.Fatal("got", d, ok)
+	}
+	if d, ok := b.Retry(JobStats{Reserves: 1000}); d <= 0 || !ok {
+		t.Fatal("expected huge positive delay, got", d, ok)
+	}
+}
+
+func TestExponentialBackoffJitter(t *testing.T) {
+	b := ExponentialBackoff{MinDelay: 10 * time.Second, Jitter: 0.5}
+	for i := 0; i < 100; i++ {
+		d, _ := b.Retry(JobStats{Reserves: 1})
+		if d < 5*time.Second || d > 10*time.Second {
+			t.Fatal("delay out of range:", d)
+		}
+	}
+}
+
+func TestExponentialBackoffJitterClamped(t *testing.T) {
+	for _, jitter := range []float64{-1, 3} {
+		b := ExponentialBackoff{MinDelay: 10 * time.Second, Jitter: jitter}
+		for i := 0; i < 100; i++ {
+			d, _ := b.Retry(JobStats{Reserves: 1})
+			if d < 0 || d > 10*time.Second || jitter < 0 && d != 10*time.Second {
+				t.Fatalf("jitter %v: delay out of range: %v", jitter, d)
+			}
+		}
+	}
+}
+
+func TestExponentialBackoffWholeSeconds(t *testing.T) {
+	b := ExponentialBackoff{MinDelay: 300 * time.Millisecond, Jitter: 0.9}
+	for i := 0; i < 100; i++ {
+		d, _ := b.Retry(JobStats{Reserves: 1})
+		if d != time.Second {
+			t.Fatal("expected delay rounded up to 1s, got", d)
+		}
+	}
+	for i := 0; i < 100; i++ {
+		d, _ := b.Retry(JobStats{Reserves: 4})
+		if d <= 0 || d%time.Second != 0 {
+			t.Fatal("expected whole seconds, got", d)
+		}
+	}
+}
+
+func TestRetrySchedule(t *testing.T) {
+	s := RetrySchedule{time.Second, time.Minute}
+	if d, ok := s.Retry(JobStats{Reserves: 2}); d != time.Minute || !ok {
+		t.Fatal("got", d, ok)
+	}
+	if _, ok := s.Retry(JobStats{Reserves: 3}); ok {
+		t.Fatal("expected schedule to be exhausted")
+	}
+}
+
+func TestWorkerRetryPolicy(t *testing.T) {
+	s := newMockServer()
+	id := s.put("a", []byte("x"), 7, 0, 60)
+	w := newTestWorker(s, nil)
+	w.RetryPolicy = RetrySchedule{0, 0}
+	w.Handle("a", func(ctx context.Context, j *Job) error {
+		return errors.New("try again")
+	})
+	stop := runWorker(t, w)
+	waitFor(t, func() bool { return s.job(id).state == "buried" })
+	stop()
+
+	if j := s.job(id); j.reserves != 3 || j.releases != 2 || j.buries != 1 || j.pri != 7 {
+		t.Fatalf("got reserves=%d releases=%d buries=%d pri=%d", j.reserves, j.releases, j.buries, j.pri)
+	}
+}
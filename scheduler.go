@@ -0,0 +1,412 @@
+package beanstalk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultLockPrefix is the default LockPrefix of a Scheduler.
+const DefaultLockPrefix = "cron-lock."
+
+// lockTTR is the TTR of the lock jobs of a Scheduler. A Scheduler that
+// dies holding a lock job holds up its entry for this long.
+const lockTTR = time.Minute
+
+// A Scheduler puts jobs into tubes on recurring schedules given by cron
+// expressions. Any number of Schedulers with the same entries may run
+// against a server, such as one on each host for redundancy; each tick
+// of an entry is enqueued at most once among them.
+//
+// To that end each entry has a lock tube, named LockPrefix followed by
+// the name of the entry, that holds a single lock job recording the
+// last tick enqueued. The lock job is delayed until the next tick, so
+// the Scheduler that reserves it then is the only one to enqueue the
+// job, after it has put a new lock job for the tick after. If
+// Schedulers are down over several ticks, only the last of them is
+// enqueued when they come back. A Scheduler that dies at the wrong
+// moment may cause a tick to be missed, but never enqueued twice.
+//
+// Schedulers that find a lock tube empty at once elect the one to put
+// its lock job: each puts a claim job into the claim tube of the entry,
+// named like the lock tube but in parentheses, and the one whose claim
+// has the lowest id goes ahead. The jobs of an entry added with
+// AddHeader carry the tick they are for in their HeaderScheduledAt
+// header.
+//
+// The server counts delays in seconds, so jobs are enqueued up to a
+// second or so after their tick; the clocks of the hosts running
+// Schedulers should agree to within a few seconds.
+//
+// The configuration fields must not be changed after Run is called.
+type Scheduler struct {
+	// Dial opens the Conn of the Scheduler.
+	Dial func(ctx context.Context) (*Conn, error)
+
+	// LockPrefix is prefixed to the name of each entry to name its lock
+	// tube. If it is empty, DefaultLockPrefix is used.
+	LockPrefix string
+
+	// Location is the time zone in which the cron expressions are
+	// read. If it is nil, time.Local is used.
+	Location *time.Location
+
+	// ReserveTimeout is the timeout of each reserve command. If it is
+	// zero, DefaultReserveTimeout is used.
+	ReserveTimeout time.Duration
+
+	// ErrorLog logs failures of the commands the Scheduler sends. If
+	// it is nil, the standard logger is used.
+	ErrorLog *log.Logger
+
+	mu      sync.Mutex
+	entries map[string]*cronEntry
+	now     func() time.Time // for tests
+}
+
+type cronEntry struct {
+	name     string
+	schedule *CronSchedule
+	tube     string
+	body     []byte
+	header   Header // nil to put the body as it is
+	pri      uint32
+	ttr      time.Duration
+}
+
+// NewScheduler returns a new Scheduler that dials addr on the given
+// network, with a timeout of DefaultDialTimeout.
+func NewScheduler(network, addr string) *Scheduler {
+	return &Scheduler{
+		Dial: func(ctx context.Context) (*Conn, error) {
+			return dialContext(ctx, network, addr, DefaultDialTimeout)
+		},
+	}
+}
+
+// Add adds an entry named name, which puts a job with the given body,
+// priority and TTR into tube at each time matched by the cron
+// expression spec; see ParseCron. Adding an entry with the name of an
+// existing one replaces it. Schedulers sharing a server should use the
+// same name for the same entry, and different names otherwise.
+func (s *Scheduler) Add(name, spec, tube string, body []byte, pri uint32, ttr time.Duration) error {
+	return s.add(name, spec, tube, body, nil, pri, ttr)
+}
+
+// AddHeader is like Add, but puts each job with Tube.PutHeader, with
+// the headers in h and HeaderScheduledAt set to the tick it is for.
+func (s *Scheduler) AddHeader(name, spec, tube string, body []byte, h Header, pri uint32, ttr time.Duration) error {
+	h2 := make(Header, len(h)+1)
+	for k, v := range h {
+		h2[k] = v
+	}
+	return s.add(name, spec, tube, body, h2, pri, ttr)
+}
+
+func (s *Scheduler) add(name, spec, tube string, body []byte, h Header, pri uint32, ttr time.Duration) error {
+	schedule, err := ParseCron(spec)
+	if err != nil {
+		return err
+	}
+	if schedule.Next(time.Now()).IsZero() {
+		return fmt.Errorf("beanstalk: cron expression %q never matches", spec)
+	}
+	if strings.ContainsRune(name, '\n') {
+		return NameError{name, ErrBadChar}
+	}
+	if err = CheckName(claimTube(s.lockTube(name))); err != nil {
+		return err
+	}
+	if err = CheckName(tube); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.entries == nil {
+		s.entries = make(map[string]*cronEntry)
+	}
+	s.entries[name] = &cronEntry{name, schedule, tube, append([]byte(nil), body...), h, pri, ttr}
+	return nil
+}
+
+// Run enqueues the jobs of the entries of s until ctx is done, and
+// then returns ctx.Err(). Entries may be added while it runs.
+func (s *Scheduler) Run(ctx context.Context) error {
+	var c *Conn
+	defer func() {
+		if c != nil {
+			c.Close()
+		}
+	}()
+	backoff := DefaultMinBackoff
+	for ctx.Err() == nil {
+		if c == nil {
+			var err error
+			c, err = s.Dial(ctx)
+			if err != nil {
+				s.logf("beanstalk: scheduler: dial: %v", err)
+				sleep(ctx, backoff)
+				if backoff *= 2; backoff > DefaultMaxBackoff {
+					backoff = DefaultMaxBackoff
+				}
+				continue
+			}
+			backoff = DefaultMinBackoff
+		}
+		err := s.step(ctx, c)
+		if err == nil || ctx.Err() != nil {
+			continue
+		}
+		switch {
+		case !c.usable() || isIOError(err):
+			s.logf("beanstalk: scheduler: %v", err)
+			c.Close()
+			c = nil
+		case errors.Is(err, ErrTimeout), errors.Is(err, ErrDeadline):
+		default:
+			s.logf("beanstalk: scheduler: %v", err)
+		}
+	}
+	return ctx.Err()
+}
+
+// step makes sure that each entry has a lock job, then waits for a
+// lock job to become ready and handles it.
+func (s *Scheduler) step(ctx context.Context, c *Conn) error {
+	s.mu.Lock()
+	entries := make([]*cronEntry, 0, len(s.entries))
+	for _, e := range s.entries {
+		entries = append(entries, e)
+	}
+	s.mu.Unlock()
+	timeout := s.ReserveTimeout
+	if timeout <= 0 {
+		timeout = DefaultReserveTimeout
+	}
+	if len(entries) == 0 {
+		sleep(ctx, timeout)
+		return nil
+	}
+
+	ts := NewTubeSet(c)
+	for _, e := range entries {
+		if err := s.ensureLock(ctx, c, e); err != nil {
+			return err
+		}
+		ts.Name[s.lockTube(e.name)] = true
+	}
+	id, body, err := ts.ReserveContext(ctx, timeout)
+	if err != nil {
+		return err
+	}
+	return s.fire(ctx, c, id, body)
+}
+
+// ensureLock puts a lock job for e, recording the current time, if its
+// lock tube is empty and its claim job is the first in the claim tube.
+func (s *Scheduler) ensureLock(ctx context.Context, c *Conn, e *cronEntry) error {
+	lock := &Tube{c, s.lockTube(e.name)}
+	n, err := lockJobs(ctx, lock)
+	if err != nil || n > 0 {
+		return err
+	}
+	claims := &Tube{c, claimTube(lock.Name)}
+	claim, err := claims.PutContext(ctx, []byte(e.name), 0, 0, lockTTR)
+	if err != nil {
+		return err
+	}
+	defer c.DeleteContext(ctx, claim)
+	first, _, err := claims.PeekReadyContext(ctx)
+	if err != nil {
+		return err
+	}
+	if first != claim {
+		// A Scheduler that died after putting its claim leaves it
+		// behind; drop it once it is too old to be in use.
+		stats, err := c.StatsJobContext(ctx, first)
+		if err == nil && time.Duration(stats.Age)*time.Second > lockTTR {
+			c.DeleteContext(ctx, first)
+		}
+		return nil
+	}
+	// The Scheduler elected before us may have put the lock job by now.
+	if n, err = lockJobs(ctx, lock); err != nil || n > 0 {
+		return err
+	}
+	now := s.clock()
+	_, err = lock.PutContext(ctx, lockBody(e.name, now), 0, delayUntil(now, e.schedule.Next(now)), lockTTR)
+	return err
+}
+
+// fire handles the reserved lock job with the given id and body: if a
+// tick of its entry is due, it moves the lock on to the next tick and
+// then puts the job of the entry.
+func (s *Scheduler) fire(ctx context.Context, c *Conn, id uint64, body []byte) error {
+	name, last, err := parseLockBody(body)
+	s.mu.Lock()
+	e := s.entries[name]
+	s.mu.Unlock()
+	if err != nil || e == nil {
+		// A lock job will be put again for entries that have one.
+		c.DeleteContext(ctx, id)
+		if err != nil {
+			return fmt.Errorf("bad lock job %d: %v", id, err)
+		}
+		return nil
+	}
+	lock := &Tube{c, s.lockTube(name)}
+
+	// A lock job may still be put twice, as when a Scheduler failed to
+	// delete the old one after putting the new one, or stalled for
+	// longer than lockTTR while elected. Keep the one with the latest
+	// tick, so that no tick is enqueued again, and of those the one
+	// with the lowest id.
+	n, err := lockJobs(ctx, lock)
+	if err != nil {
+		c.ReleaseContext(ctx, id, 0, 0)
+		return err
+	}
+	if n > 1 {
+		other, otherLast, err := peekLock(ctx, lock)
+		switch {
+		case err != nil:
+			c.ReleaseContext(ctx, id, 0, 0)
+			return err
+		case other == 0:
+			// The others are reserved; look again when they are not.
+			return c.ReleaseContext(ctx, id, 0, time.Second)
+		case otherLast.After(last) || otherLast.Equal(last) && other < id:
+			return c.DeleteContext(ctx, id)
+		}
+		err = c.DeleteContext(ctx, other)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			c.ReleaseContext(ctx, id, 0, 0)
+			return err
+		}
+		return c.ReleaseContext(ctx, id, 0, 0)
+	}
+
+	now := s.clock()
+	tick := e.schedule.Next(last.In(now.Location()))
+	if tick.After(now) {
+		// Early, as when the clocks of Schedulers disagree.
+		return c.ReleaseContext(ctx, id, 0, delayUntil(now, tick))
+	}
+	for next := e.schedule.Next(tick); !next.IsZero() && !next.After(now); next = e.schedule.Next(tick) {
+		tick = next // skip the ticks that were missed
+	}
+	next := e.schedule.Next(tick)
+	if next.IsZero() {
+		next = now.AddDate(5, 0, 0)
+	}
+	// Put the new lock job before deleting the old one, so that the
+	// lock tube is never empty; and don't put the job unless the old
+	// one is gone, so that it cannot enqueue the tick again.
+	if _, err = lock.PutContext(ctx, lockBody(name, tick), 0, delayUntil(now, next), lockTTR); err != nil {
+		c.ReleaseContext(ctx, id, 0, 0)
+		return err
+	}
+	if err = c.DeleteContext(ctx, id); err != nil {
+		return err
+	}
+	t := &Tube{c, e.tube}
+	if e.header == nil {
+		_, err = t.PutContext(ctx, e.body, e.pri, 0, e.ttr)
+	} else {
+		h := make(Header, len(e.header)+1)
+		for k, v := range e.header {
+			h[k] = v
+		}
+		h[HeaderScheduledAt] = tick.Format(time.RFC3339)
+		_, err = t.PutHeaderContext(ctx, e.body, h, e.pri, 0, e.ttr)
+	}
+	if err != nil {
+		return fmt.Errorf("entry %s: %v", name, err)
+	}
+	return nil
+}
+
+// lockJobs returns the number of jobs in the lock tube, in any state.
+func lockJobs(ctx context.Context, lock *Tube) (uint64, error) {
+	stats, err := lock.StatsContext(ctx)
+	if e, ok := err.(ConnError); ok && e.Err == ErrNotFound {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	return stats.CurrentJobsReady + stats.CurrentJobsReserved + stats.CurrentJobsDelayed + stats.CurrentJobsBuried, nil
+}
+
+// peekLock returns the id and the last tick of a lock job that is not
+// reserved, or a zero id if there is none. A lock job with a bad body
+// has the zero Time as its last tick, so it is the one dropped.
+func peekLock(ctx context.Context, lock *Tube) (uint64, time.Time, error) {
+	for _, peek := range []func(context.Context) (uint64, []byte, error){
+		lock.PeekReadyContext, lock.PeekDelayedContext, lock.PeekBuriedContext,
+	} {
+		id, body, err := peek(ctx)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		} else if err != nil {
+			return 0, time.Time{}, err
+		}
+		_, last, _ := parseLockBody(body)
+		return id, last, nil
+	}
+	return 0, time.Time{}, nil
+}
+
+// The body of a lock job is the name of its entry and the Unix time of
+// its last tick, on two lines.
+func lockBody(name string, tick time.Time) []byte {
+	return []byte(name + "\n" + strconv.FormatInt(tick.Unix(), 10))
+}
+
+func parseLockBody(body []byte) (name string, last time.Time, err error) {
+	name, sec, ok := strings.Cut(string(body), "\n")
+	if !ok {
+		return "", time.Time{}, errors.New("no tick")
+	}
+	n, err := strconv.ParseInt(sec, 10, 64)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return name, time.Unix(n, 0), nil
+}
+
+func (s *Scheduler) lockTube(name string) string {
+	if s.LockPrefix == "" {
+		return DefaultLockPrefix + name
+	}
+	return s.LockPrefix + name
+}
+
+// claimTube returns the name of the claim tube that goes with the lock
+// tube named lock.
+func claimTube(lock string) string {
+	return "(" + lock + ")"
+}
+
+func (s *Scheduler) clock() time.Time {
+	now := time.Now()
+	if s.now != nil {
+		now = s.now()
+	}
+	if s.Location != nil {
+		return now.In(s.Location)
+	}
+	return now.In(time.Local)
+}
+
+func (s *Scheduler) logf(format string, args ...interface{}) {
+	if s.ErrorLog != nil {
+		s.ErrorLog.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
@@ -0,0 +1,208 @@
+package beanstalk
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) add(d time.Duration) {
+	c.mu.Lock()
+	c.t = c.t.Add(d)
+	c.mu.Unlock()
+}
+
+func newTestScheduler(t *testing.T, s *mockServer, clock *fakeClock) *Scheduler {
+	sc := &Scheduler{
+		Dial:     s.Dial,
+		Location: time.UTC,
+		ErrorLog: log.New(new(bytes.Buffer), "", 0),
+		now:      clock.now,
+	}
+	h := Header{HeaderProducer: "test"}
+	if err := sc.AddHeader("e", "* * * * *", "out", []byte("tick"), h, 1, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	return sc
+}
+
+func runScheduler(t *testing.T, sc *Scheduler) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- sc.Run(ctx) }()
+	return func() {
+		cancel()
+		if err := <-done; err != context.Canceled {
+			t.Fatal("expected context.Canceled, got", err)
+		}
+	}
+}
+
+func TestScheduler(t *testing.T) {
+	s := newMockServer()
+	clock := &fakeClock{t: time.Date(2020, 1, 1, 0, 0, 30, 0, time.UTC)}
+	stop := runScheduler(t, newTestScheduler(t, s, clock))
+	defer stop()
+
+	lock := DefaultLockPrefix + "e"
+	waitFor(t, func() bool { return s.count(lock, "delayed") == 1 })
+	if j := s.first(map[string]bool{lock: true}, "delayed"); j.delay != 30 {
+		t.Fatal("expected lock job delayed until the next minute, got", j.delay)
+	}
+
+	// The delay runs out.
+	clock.add(30*time.Second + time.Millisecond)
+	s.kick(lock, 1)
+	waitFor(t, func() bool { return s.count("out", "ready") == 1 })
+	waitFor(t, func() bool { return s.count(lock, "delayed") == 1 && s.count(lock, "ready") == 0 })
+	j := s.first(map[string]bool{"out": true}, "ready")
+	h, body, err := decodeEnvelope(j.body)
+	if err != nil || string(body) != "tick" || j.pri != 1 || j.ttr != 60 {
+		t.Fatalf("got job %q pri %d ttr %d (%v)", body, j.pri, j.ttr, err)
+	}
+	if at := h[HeaderScheduledAt]; at != "2020-01-01T00:01:00Z" {
+		t.Fatal("expected the tick in the header, got", at)
+	}
+	if p := h[HeaderProducer]; p != "test" {
+		t.Fatal("expected the headers of the entry, got", h)
+	}
+
+	// A lock job that is ready early is put back.
+	s.kick(lock, 1)
+	waitFor(t, func() bool { return s.count(lock, "delayed") == 1 && s.count(lock, "ready") == 0 })
+	if n := s.count("out", "ready"); n != 1 {
+		t.Fatal("expected no job for an early lock job, got", n)
+	}
+
+	// Missed ticks are enqueued once.
+	clock.add(10 * time.Minute)
+	s.kick(lock, 1)
+	waitFor(t, func() bool { return s.count("out", "ready") == 2 })
+	waitFor(t, func() bool { return s.count(lock, "delayed") == 1 && s.count(lock, "ready") == 0 })
+	if n := s.count("out", "ready"); n != 2 {
+		t.Fatal("expected one job for the missed ticks, got", n)
+	}
+}
+
+func TestSchedulerPlainBody(t *testing.T) {
+	s := newMockServer()
+	clock := &fakeClock{t: time.Date(2020, 1, 1, 0, 0, 30, 0, time.UTC)}
+	sc := newTestScheduler(t, s, clock)
+	if err := sc.Add("e", "* * * * *", "out", []byte("tick"), 1, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	stop := runScheduler(t, sc)
+	defer stop()
+
+	lock := DefaultLockPrefix + "e"
+	waitFor(t, func() bool { return s.count(lock, "delayed") == 1 })
+	clock.add(30*time.Second + time.Millisecond)
+	s.kick(lock, 1)
+	waitFor(t, func() bool { return s.count("out", "ready") == 1 })
+	if j := s.first(map[string]bool{"out": true}, "ready"); string(j.body) != "tick" {
+		t.Fatalf("expected the body as given, got %q", j.body)
+	}
+}
+
+func TestSchedulerMany(t *testing.T) {
+	s := newMockServer()
+	clock := &fakeClock{t: time.Date(2020, 1, 1, 0, 0, 30, 0, time.UTC)}
+
+	// Start the Schedulers at the same instant, so that they all find
+	// the lock tube empty.
+	start := make(chan struct{})
+	for i := 0; i < 3; i++ {
+		sc := newTestScheduler(t, s, clock)
+		sc.Dial = func(ctx context.Context) (*Conn, error) {
+			<-start
+			return s.Dial(ctx)
+		}
+		stop := runScheduler(t, sc)
+		defer stop()
+	}
+	close(start)
+
+	lock := DefaultLockPrefix + "e"
+	waitFor(t, func() bool {
+		return s.count(lock, "delayed") == 1 && s.count(claimTube(lock), "ready") == 0
+	})
+	const ticks = 10
+	for i := 1; i <= ticks; i++ {
+		clock.add(time.Minute)
+		s.kick(lock, 10)
+		waitFor(t, func() bool {
+			return s.count("out", "ready") >= i && s.count(lock, "delayed") == 1 &&
+				s.count(lock, "ready") == 0 && s.count(lock, "reserved") == 0
+		})
+	}
+
+	enqueued := make(map[string]int)
+	s.mu.Lock()
+	for _, j := range s.jobs {
+		if j.tube == "out" {
+			h, _, _ := decodeEnvelope(j.body)
+			enqueued[h[HeaderScheduledAt]]++
+		}
+	}
+	s.mu.Unlock()
+	for i := 1; i <= ticks; i++ {
+		tick := time.Date(2020, 1, 1, 0, i, 0, 0, time.UTC).Format(time.RFC3339)
+		if n := enqueued[tick]; n != 1 {
+			t.Errorf("tick %s enqueued %d times", tick, n)
+		}
+	}
+	if len(enqueued) != ticks {
+		t.Errorf("expected %d ticks enqueued, got %v", ticks, enqueued)
+	}
+}
+
+func TestSchedulerDuplicateLock(t *testing.T) {
+	s := newMockServer()
+	clock := &fakeClock{t: time.Date(2020, 1, 1, 0, 1, 30, 0, time.UTC)}
+
+	// A stale lock job was left behind along with the current one; the
+	// one with the latest tick wins.
+	lock := DefaultLockPrefix + "e"
+	stale := s.put(lock, lockBody("e", time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)), 0, 0, 60)
+	s.put(lock, lockBody("e", time.Date(2020, 1, 1, 0, 1, 0, 0, time.UTC)), 0, 30, 60)
+	stop := runScheduler(t, newTestScheduler(t, s, clock))
+	defer stop()
+
+	waitFor(t, func() bool { return s.job(stale) == nil })
+	clock.add(time.Minute)
+	s.kick(lock, 1)
+	waitFor(t, func() bool { return s.count("out", "ready") == 1 })
+	waitFor(t, func() bool { return s.count(lock, "delayed") == 1 && s.count(lock, "ready") == 0 })
+	h, _, _ := decodeEnvelope(s.first(map[string]bool{"out": true}, "ready").body)
+	if at := h[HeaderScheduledAt]; at != "2020-01-01T00:02:00Z" {
+		t.Fatal("expected only the next tick enqueued, got", at)
+	}
+}
+
+func TestSchedulerAdd(t *testing.T) {
+	sc := new(Scheduler)
+	for _, tt := range []struct{ name, spec, tube string }{
+		{"e", "* * *", "out"},
+		{"e", "0 0 30 2 *", "out"},
+		{"e\n", "* * * * *", "out"},
+		{"e", "* * * * *", "bad tube"},
+	} {
+		if err := sc.Add(tt.name, tt.spec, tt.tube, nil, 0, 0); err == nil {
+			t.Errorf("Add(%q, %q, %q): expected error", tt.name, tt.spec, tt.tube)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package beanstalk
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+var errBodyClosed = errors.New("read of closed body")
+
+// A BodyReader reads the body of a reserved job straight from the
+// connection, so that memory use does not grow with the size of the
+// job. Responses to later commands on the Conn cannot be read until
+// the BodyReader is closed, so it should be closed promptly, and
+// before waiting on other commands from the same goroutine.
+//
+// A BodyReader is not safe for concurrent use.
+type BodyReader struct {
+	Size int64 // the size of the body
+
+	c      *Conn
+	ctx    context.Context
+	r      req
+	lr     io.LimitedReader
+	err    error
+	closed bool
+}
+
+// Read reads from the body. It returns io.EOF at the end of the body.
+func (b *BodyReader) Read(p []byte) (int, error) {
+	if b.closed {
+		return 0, ConnError{b.c, b.r.op, errBodyClosed}
+	}
+	if b.err != nil {
+		return 0, b.err
+	}
+	if b.lr.N == 0 {
+		return 0, io.EOF
+	}
+	stop := b.c.watchRead(b.ctx, 0)
+	n, err := b.lr.Read(p)
+	stop()
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		b.err = b.c.ioError(b.ctx, b.r.op, err)
+		return n, b.err
+	}
+	return n, nil
+}
+
+// Close discards the unread part of the body and lets the Conn go on
+// to read the next response.
+func (b *BodyReader) Close() error {
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	defer b.c.p.EndResponse(b.r.id)
+	if b.err != nil {
+		return nil
+	}
+	stop := b.c.watchRead(b.ctx, 0)
+	_, err := b.c.r.Discard(int(b.lr.N) + 2) // trailing CR NL
+	stop()
+	if err != nil {
+		return b.c.ioError(b.ctx, b.r.op, err)
+	}
+	return nil
+}
+
+// PutFrom is like Put, but copies the body of size bytes from src as it
+// is written to the connection, without buffering it whole. If reading
+// src fails or yields fewer than size bytes, the server is left waiting
+// for the rest of the body, so the Conn becomes unusable; the error
+// from src, or io.ErrUnexpectedEOF, is recorded in the ConnError.
+// The body is sent as it is, without an envelope or Transformers.
+func (t *Tube) PutFrom(src io.Reader, size int64, pri uint32, delay, ttr time.Duration) (id uint64, err error) {
+	return t.PutFromContext(context.Background(), src, size, pri, delay, ttr)
+}
+
+// PutFromContext is like PutFrom, but takes a context.
+func (t *Tube) PutFromContext(ctx context.Context, src io.Reader, size int64, pri uint32, delay, ttr time.Duration) (id uint64, err error) {
+	body := &bodySource{r: src, size: size}
+	r, err := t.Conn.cmdSource(ctx, t, nil, body, "put", "", uint64(pri), dur(delay), dur(ttr))
+	if err != nil {
+		return 0, err
+	}
+	return t.Conn.readPut(ctx, r)
+}
+
+// ReserveReader is like Reserve, but returns a BodyReader over the body
+// of the job instead of reading it into memory. The caller must close
+// the BodyReader. The context of ReserveReaderContext also applies to
+// reading the body. The body is returned as stored, without undoing
+// envelopes or Transformers.
+func (t *TubeSet) ReserveReader(timeout time.Duration) (id uint64, body *BodyReader, err error) {
+	return t.ReserveReaderContext(context.Background(), timeout)
+}
+
+// ReserveReaderContext is like ReserveReader, but takes a context.
+func (t *TubeSet) ReserveReaderContext(ctx context.Context, timeout time.Duration) (id uint64, body *BodyReader, err error) {
+	c := t.Conn
+	r, err := c.cmd(ctx, nil, t, nil, "reserve-with-timeout", dur(timeout))
+	if err != nil {
+		return 0, nil, err
+	}
+	r.block = timeout
+	if err = c.startResponse(ctx, r, true); err != nil {
+		return 0, nil, err
+	}
+	body = &BodyReader{c: c, ctx: ctx, r: r}
+	body.lr.R = c.r
+	r.sink.stream = body
+	header, _, err := c.readRawResp(ctx, r, true)
+	if err != nil {
+		c.p.EndResponse(r.id)
+		return 0, nil, err
+	}
+	var args [1]uint64
+	if err = c.scan(header, "RESERVED", args[:]); err != nil {
+		body.Close()
+		return 0, nil, ConnError{c, r.op, err}
+	}
+	return args[0], body, nil
+}
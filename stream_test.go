@@ -0,0 +1,131 @@
+package beanstalk
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPutFrom(t *testing.T) {
+	c := NewConn(mock("put 0 0 0 3\r\nabc\r\n", "INSERTED 1\r\n"))
+	id, err := c.PutFrom(strings.NewReader("abcdef"), 3, 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 1 {
+		t.Fatal("expected 1, got", id)
+	}
+}
+
+func TestPutFromShort(t *testing.T) {
+	c := NewConn(mock("", ""))
+	_, err := c.PutFrom(strings.NewReader("ab"), 3, 0, 0, 0)
+	if e, ok := err.(ConnError); !ok || e.Err != io.ErrUnexpectedEOF {
+		t.Fatal("expected io.ErrUnexpectedEOF, got", err)
+	}
+	if _, err = c.Peek(1); !errors.Is(err, ErrUnusable) {
+		t.Fatal("expected ErrUnusable, got", err)
+	}
+}
+
+func TestPutFromReadError(t *testing.T) {
+	c := NewConn(mock("", ""))
+	bad := errors.New("bad source")
+	_, err := c.PutFrom(io.MultiReader(strings.NewReader("a"), errReader{bad}), 3, 0, 0, 0)
+	if !errors.Is(err, bad) {
+		t.Fatal("expected source error, got", err)
+	}
+}
+
+type errReader struct{ err error }
+
+func (r errReader) Read([]byte) (int, error) { return 0, r.err }
+
+func TestReserveReader(t *testing.T) {
+	c := NewConn(mock(
+		"reserve-with-timeout 1\r\npeek 2\r\n",
+		"RESERVED 1 3\r\nabc\r\nFOUND 2 1\r\nx\r\n",
+	))
+	id, body, err := c.ReserveReader(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 1 || body.Size != 3 || string(b) != "abc" {
+		t.Fatalf("got %d %d %q", id, body.Size, b)
+	}
+	if err = body.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = body.Read(b); err == nil {
+		t.Fatal("expected error reading closed body")
+	}
+	if p, err := c.Peek(2); err != nil || string(p) != "x" {
+		t.Fatal("got", p, err)
+	}
+}
+
+func TestReserveReaderCloseUnread(t *testing.T) {
+	c := NewConn(mock(
+		"reserve-with-timeout 1\r\npeek 2\r\n",
+		"RESERVED 1 3\r\nabc\r\nFOUND 2 1\r\nx\r\n",
+	))
+	_, body, err := c.ReserveReader(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b [1]byte
+	if _, err = body.Read(b[:]); err != nil {
+		t.Fatal(err)
+	}
+	if err = body.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if p, err := c.Peek(2); err != nil || string(p) != "x" {
+		t.Fatal("got", p, err)
+	}
+}
+
+func TestReserveReaderTimeout(t *testing.T) {
+	c := NewConn(mock(
+		"reserve-with-timeout 1\r\npeek 2\r\n",
+		"TIMED_OUT\r\nFOUND 2 1\r\nx\r\n",
+	))
+	if _, _, err := c.ReserveReader(time.Second); !errors.Is(err, ErrTimeout) {
+		t.Fatal("expected ErrTimeout, got", err)
+	}
+	if p, err := c.Peek(2); err != nil || string(p) != "x" {
+		t.Fatal("got", p, err)
+	}
+}
+
+func TestStreamLargeBody(t *testing.T) {
+	s := newMockServer()
+	c := s.Conn()
+	defer c.Close()
+	big := bytes.Repeat([]byte("0123456789abcdef"), 1<<16) // 1MiB
+
+	if _, err := c.PutFrom(bytes.NewReader(big), int64(len(big)), 0, 0, 60); err != nil {
+		t.Fatal(err)
+	}
+	_, body, err := c.ReserveReader(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got bytes.Buffer
+	if _, err = io.Copy(&got, body); err != nil {
+		t.Fatal(err)
+	}
+	if err = body.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Bytes(), big) {
+		t.Fatal("body mismatch")
+	}
+}
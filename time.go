@@ -7,3 +7,14 @@ import (
 func dur(d time.Duration) uint64 {
 	return uint64(d.Seconds())
 }
+
+// delayUntil returns the delay from now until t, rounded up to whole
+// seconds, since the server counts delays in seconds, so that a job put
+// with it is not ready before t.
+func delayUntil(now, t time.Time) time.Duration {
+	d := t.Sub(now)
+	if d <= 0 {
+		return 0
+	}
+	return (d + time.Second - 1).Truncate(time.Second)
+}
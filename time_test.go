@@ -10,3 +10,21 @@ func TestFormatDuration(t *testing.T) {
 		t.Fatal("got", s, "expected 100")
 	}
 }
+
+func TestDelayUntil(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		at   time.Duration
+		want time.Duration
+	}{
+		{-time.Second, 0},
+		{0, 0},
+		{time.Millisecond, time.Second},
+		{time.Second, time.Second},
+		{1500 * time.Millisecond, 2 * time.Second},
+	} {
+		if got := delayUntil(now, now.Add(tt.at)); got != tt.want {
+			t.Errorf("delayUntil(%v) = %v, want %v", tt.at, got, tt.want)
+		}
+	}
+}
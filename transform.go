@@ -0,0 +1,144 @@
+package beanstalk
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+)
+
+// A Transformer rewrites job bodies on their way to and from the
+// server, such as to compress them. The Transformers of a Conn are
+// applied in order by the put methods, after any envelope has been
+// added, and undone in reverse order when jobs are reserved or peeked.
+//
+// Encode returns the body to store for a job put in tube. Decode must
+// undo it, and must return bodies that Encode did not produce
+// unchanged, so that jobs put by Conns with other Transformers, or
+// none, can be read too, unless rejecting them is the point, as for a
+// Signer. Both are passed the context of the command that puts or
+// reads the job, and may be called concurrently.
+//
+// The methods that stream bodies, such as Tube.PutFrom and
+// TubeSet.ReserveReader, bypass the Transformers.
+type Transformer interface {
+	Encode(ctx context.Context, tube string, body []byte) ([]byte, error)
+	Decode(ctx context.Context, body []byte) ([]byte, error)
+}
+
+// SetTransformers sets the Transformers applied to job bodies by c,
+// replacing any set before, such as by Config.Transformers. It should
+// be called before c is used to put or read jobs.
+func (c *Conn) SetTransformers(t ...Transformer) {
+	c.mu.Lock()
+	c.transform = append([]Transformer(nil), t...)
+	c.mu.Unlock()
+}
+
+func (c *Conn) transformers() []Transformer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.transform
+}
+
+// encodeJob returns the body to send for a job with the given headers
+// and body, to be put in tube, and the blobs stored for it by any
+// ClaimCheck, which are to be deleted if the put fails; see dropClaims.
+func (c *Conn) encodeJob(ctx context.Context, tube string, h Header, body []byte) ([]byte, []claim, error) {
+	if h != nil {
+		body = encodeEnvelope(h, body)
+	}
+	var claims []claim
+	for _, t := range c.transformers() {
+		var err error
+		if body, err = t.Encode(ctx, tube, body); err != nil {
+			dropClaims(ctx, claims)
+			return nil, nil, err
+		}
+		if cc, ok := t.(*ClaimCheck); ok {
+			if key, ok := claimKey(body); ok {
+				claims = append(claims, claim{cc.Store, key})
+			}
+		}
+	}
+	return body, claims, nil
+}
+
+// decodeJob undoes encodeJob for the job with the given id and body.
+func (c *Conn) decodeJob(ctx context.Context, id uint64, body []byte) (Header, []byte, error) {
+	return c.decode(ctx, id, body, nil)
+}
+
+// decode is like decodeJob, but also appends the blobs read by any
+// ClaimCheck to claims, if it is not nil.
+func (c *Conn) decode(ctx context.Context, id uint64, body []byte, claims *[]claim) (Header, []byte, error) {
+	ts := c.transformers()
+	for i := len(ts) - 1; i >= 0; i-- {
+		if cc, ok := ts[i].(*ClaimCheck); ok && claims != nil {
+			if key, ok := claimKey(body); ok {
+				*claims = append(*claims, claim{cc.Store, key})
+			}
+		}
+		var err error
+		if body, err = ts[i].Decode(ctx, body); err != nil {
+			_, cc := ts[i].(*ClaimCheck)
+			return nil, nil, &DecodeError{Id: id, Err: err, transient: cc && !errors.Is(err, fs.ErrNotExist)}
+		}
+	}
+	h, body, err := decodeEnvelope(body)
+	if err != nil {
+		return nil, nil, &DecodeError{Id: id, Err: err}
+	}
+	return h, body, nil
+}
+
+// claimsOf returns the blobs that body, as stored, refers to. It undoes
+// the Transformers that come after any ClaimCheck to find them, but
+// does not fetch the blobs.
+func (c *Conn) claimsOf(ctx context.Context, body []byte) []claim {
+	ts := c.transformers()
+	for i := len(ts) - 1; i >= 0; i-- {
+		if cc, ok := ts[i].(*ClaimCheck); ok {
+			if key, ok := claimKey(body); ok {
+				return []claim{{cc.Store, key}}
+			}
+			continue
+		}
+		var err error
+		if body, err = ts[i].Decode(ctx, body); err != nil {
+			return nil
+		}
+	}
+	return nil
+}
+
+// decodeReserved is like decodeJob, but for a job reserved by c, which
+// it buries if it cannot be decoded, or releases if decoding may yet
+// succeed; see DecodeError. It records the blobs of the job for
+// deletion along with it.
+func (c *Conn) decodeReserved(ctx context.Context, id uint64, body []byte) (Header, []byte, error) {
+	var claims []claim
+	h, body, err := c.decode(ctx, id, body, &claims)
+	if err == nil {
+		if claims != nil {
+			c.keepClaims(id, claims)
+		}
+		return h, body, nil
+	}
+	de := err.(*DecodeError)
+	if ctx.Err() != nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		de.transient = true
+	}
+	// The job is let go even if ctx is done, as when it is why
+	// decoding failed.
+	ctx = context.WithoutCancel(ctx)
+	var pri uint32
+	if stats, serr := c.StatsJobContext(ctx, id); serr == nil {
+		pri = uint32(stats.Pri)
+	}
+	if de.transient {
+		de.Released = c.ReleaseContext(ctx, id, pri, 0) == nil
+	} else {
+		de.Buried = c.BuryContext(ctx, id, pri) == nil
+	}
+	return nil, nil, err
+}
@@ -1,6 +1,7 @@
 package beanstalk
 
 import (
+	"context"
 	"time"
 )
 
@@ -66,34 +67,193 @@ var tubeStatToIdx = map[string]int{
 // wait the given amount of time after returning to the client and before
 // putting the job into the ready queue.
 func (t *Tube) Put(body []byte, pri uint32, delay, ttr time.Duration) (id uint64, err error) {
-	r, err := t.Conn.cmd(t, nil, body, "put", uint64(pri), dur(delay), dur(ttr))
+	return t.PutContext(context.Background(), body, pri, delay, ttr)
+}
+
+// PutContext is like Put, but takes a context.
+func (t *Tube) PutContext(ctx context.Context, body []byte, pri uint32, delay, ttr time.Duration) (id uint64, err error) {
+	return t.put(ctx, nil, body, pri, delay, ttr)
+}
+
+// PutAt is like Put, but the job becomes ready at time at rather than
+// after a delay. The server counts delays in whole seconds, so the job
+// becomes ready up to a second after at, but never before. If at is in
+// the past, the job is ready right away.
+func (t *Tube) PutAt(body []byte, at time.Time, pri uint32, ttr time.Duration) (id uint64, err error) {
+	return t.PutAtContext(context.Background(), body, at, pri, ttr)
+}
+
+// PutAtContext is like PutAt, but takes a context.
+func (t *Tube) PutAtContext(ctx context.Context, body []byte, at time.Time, pri uint32, ttr time.Duration) (id uint64, err error) {
+	return t.PutContext(ctx, body, pri, delayUntil(time.Now(), at), ttr)
+}
+
+func (t *Tube) put(ctx context.Context, h Header, body []byte, pri uint32, delay, ttr time.Duration) (id uint64, err error) {
+	body, claims, err := t.Conn.encodeJob(ctx, t.Name, h, body)
 	if err != nil {
 		return 0, err
 	}
-	var header []byte
-	header, _, err = t.Conn.readRawResp(r, false)
+	r, err := t.Conn.cmd(ctx, t, nil, body, "put", uint64(pri), dur(delay), dur(ttr))
 	if err != nil {
+		dropClaims(ctx, claims)
 		return 0, err
 	}
+	id, err = t.Conn.readPut(ctx, r)
+	if notStored(err) {
+		dropClaims(ctx, claims)
+	}
+	return id, err
+}
+
+// putRaw puts body as it is, without encoding it.
+func (t *Tube) putRaw(ctx context.Context, body []byte, pri uint32, delay, ttr time.Duration) (id uint64, err error) {
+	r, err := t.Conn.cmd(ctx, t, nil, body, "put", uint64(pri), dur(delay), dur(ttr))
+	if err != nil {
+		return 0, err
+	}
+	return t.Conn.readPut(ctx, r)
+}
+
+// PutAsync is like Put, but returns as soon as the command has been
+// sent. The id of the new job is delivered through the Future.
+func (t *Tube) PutAsync(body []byte, pri uint32, delay, ttr time.Duration) *Future {
+	ctx := context.Background()
+	body, claims, err := t.Conn.encodeJob(ctx, t.Name, nil, body)
+	if err != nil {
+		return t.Conn.async(req{}, err, nil)
+	}
+	r, err := t.Conn.cmd(ctx, t, nil, body, "put", uint64(pri), dur(delay), dur(ttr))
+	if err != nil {
+		dropClaims(ctx, claims)
+	}
+	return t.Conn.async(r, err, func(r req) (uint64, []byte, error) {
+		id, err := t.Conn.readPut(ctx, r)
+		if notStored(err) {
+			dropClaims(ctx, claims)
+		}
+		return id, nil, err
+	})
+}
+
+func (c *Conn) readPut(ctx context.Context, r req) (uint64, error) {
+	err := c.startResponse(ctx, r, false)
+	if err != nil {
+		return 0, err
+	}
+	defer c.p.EndResponse(r.id)
+	header, _, err := c.readRawResp(ctx, r, false)
+	if err != nil {
+		return 0, err
+	}
+	return c.parsePut(r.op, header)
+}
+
+// parsePut parses the response to a put command. A job that the server
+// buried for lack of memory has its id returned along with ErrBuried.
+func (c *Conn) parsePut(op string, header []byte) (uint64, error) {
 	var args [1]uint64
-	err = t.Conn.scan(header, "INSERTED", args[:])
+	err := c.scan(header, "INSERTED", args[:])
 	if err != nil {
-		err = t.Conn.scan(header, "BURIED", args[:])
+		err = c.scan(header, "BURIED", args[:])
 		if err == nil {
-			err = ConnError{t.Conn, r.op, ErrBuried}
+			err = ErrBuried
 		}
+		return args[0], ConnError{c, op, err}
+	}
+	return args[0], nil
+}
+
+// notStored reports whether err, the error of the response to a put,
+// means that the server did not store the job.
+func notStored(err error) bool {
+	e, ok := err.(ConnError)
+	if !ok {
+		return false
+	}
+	switch e.Err {
+	case ErrBadFormat, ErrDraining, ErrInternal, ErrJobTooBig, ErrNoCRLF, ErrOOM, ErrUnknown:
+		return true
 	}
-	return args[0], err
+	return false
 }
 
 // PeekReady gets a copy of the job at the front of t's ready queue.
 func (t *Tube) PeekReady() (id uint64, body []byte, err error) {
-	r, err := t.Conn.cmd(t, nil, nil, "peek-ready")
+	return t.PeekReadyContext(context.Background())
+}
+
+// PeekReadyContext is like PeekReady, but takes a context.
+func (t *Tube) PeekReadyContext(ctx context.Context) (id uint64, body []byte, err error) {
+	j, err := t.peekJob(ctx, t.peekReady)
+	if err != nil {
+		return 0, nil, err
+	}
+	return j.Id, j.Body, nil
+}
+
+// PeekReadyJob is like PeekReady, but returns the job as a Job.
+func (t *Tube) PeekReadyJob() (*Job, error) {
+	return t.PeekReadyJobContext(context.Background())
+}
+
+// PeekReadyJobContext is like PeekReadyJob, but takes a context.
+func (t *Tube) PeekReadyJobContext(ctx context.Context) (*Job, error) {
+	return t.peekJob(ctx, t.peekReady)
+}
+
+// peekJob runs peek, one of the peek methods of t below, retrying it if
+// it is interrupted by a reconnection, and decodes the job it returns.
+func (t *Tube) peekJob(ctx context.Context, peek func(context.Context) (uint64, []byte, error)) (*Job, error) {
+	var (
+		id   uint64
+		body []byte
+	)
+	err := t.Conn.idempotent(func() (err error) {
+		id, body, err = peek(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	h, body, err := t.Conn.decodeJob(ctx, id, body)
+	if err != nil {
+		return nil, err
+	}
+	return &Job{Id: id, Body: body, Header: h, Tube: t.Name, Conn: t.Conn}, nil
+}
+
+// rawPeek returns a function that peeks at the next job in t in the
+// given state, retrying if it is interrupted by a reconnection, and
+// returns its body as stored on the server. It returns nil for an
+// unknown state.
+func (t *Tube) rawPeek(state string) func(context.Context) (uint64, []byte, error) {
+	var peek func(context.Context) (uint64, []byte, error)
+	switch state {
+	case "ready":
+		peek = t.peekReady
+	case "delayed":
+		peek = t.peekDelayed
+	case "buried":
+		peek = t.peekBuried
+	default:
+		return nil
+	}
+	return func(ctx context.Context) (id uint64, body []byte, err error) {
+		err = t.Conn.idempotent(func() error {
+			id, body, err = peek(ctx)
+			return err
+		})
+		return id, body, err
+	}
+}
+
+func (t *Tube) peekReady(ctx context.Context) (id uint64, body []byte, err error) {
+	r, err := t.Conn.cmd(ctx, t, nil, nil, "peek-ready")
 	if err != nil {
 		return 0, nil, err
 	}
 	var args [1]uint64
-	body, err = t.Conn.readRespArgs(r, true, "FOUND", args[:])
+	body, err = t.Conn.readRespArgs(ctx, r, true, "FOUND", args[:])
 	if err != nil {
 		return 0, nil, err
 	}
@@ -103,12 +263,35 @@ func (t *Tube) PeekReady() (id uint64, body []byte, err error) {
 // PeekDelayed gets a copy of the delayed job that is next to be
 // put in t's ready queue.
 func (t *Tube) PeekDelayed() (id uint64, body []byte, err error) {
-	r, err := t.Conn.cmd(t, nil, nil, "peek-delayed")
+	return t.PeekDelayedContext(context.Background())
+}
+
+// PeekDelayedContext is like PeekDelayed, but takes a context.
+func (t *Tube) PeekDelayedContext(ctx context.Context) (id uint64, body []byte, err error) {
+	j, err := t.peekJob(ctx, t.peekDelayed)
+	if err != nil {
+		return 0, nil, err
+	}
+	return j.Id, j.Body, nil
+}
+
+// PeekDelayedJob is like PeekDelayed, but returns the job as a Job.
+func (t *Tube) PeekDelayedJob() (*Job, error) {
+	return t.PeekDelayedJobContext(context.Background())
+}
+
+// PeekDelayedJobContext is like PeekDelayedJob, but takes a context.
+func (t *Tube) PeekDelayedJobContext(ctx context.Context) (*Job, error) {
+	return t.peekJob(ctx, t.peekDelayed)
+}
+
+func (t *Tube) peekDelayed(ctx context.Context) (id uint64, body []byte, err error) {
+	r, err := t.Conn.cmd(ctx, t, nil, nil, "peek-delayed")
 	if err != nil {
 		return 0, nil, err
 	}
 	var args [1]uint64
-	body, err = t.Conn.readRespArgs(r, true, "FOUND", args[:])
+	body, err = t.Conn.readRespArgs(ctx, r, true, "FOUND", args[:])
 	if err != nil {
 		return 0, nil, err
 	}
@@ -118,12 +301,35 @@ func (t *Tube) PeekDelayed() (id uint64, body []byte, err error) {
 // PeekBuried gets a copy of the job in the holding area that would
 // be kicked next by Kick.
 func (t *Tube) PeekBuried() (id uint64, body []byte, err error) {
-	r, err := t.Conn.cmd(t, nil, nil, "peek-buried")
+	return t.PeekBuriedContext(context.Background())
+}
+
+// PeekBuriedContext is like PeekBuried, but takes a context.
+func (t *Tube) PeekBuriedContext(ctx context.Context) (id uint64, body []byte, err error) {
+	j, err := t.peekJob(ctx, t.peekBuried)
+	if err != nil {
+		return 0, nil, err
+	}
+	return j.Id, j.Body, nil
+}
+
+// PeekBuriedJob is like PeekBuried, but returns the job as a Job.
+func (t *Tube) PeekBuriedJob() (*Job, error) {
+	return t.PeekBuriedJobContext(context.Background())
+}
+
+// PeekBuriedJobContext is like PeekBuriedJob, but takes a context.
+func (t *Tube) PeekBuriedJobContext(ctx context.Context) (*Job, error) {
+	return t.peekJob(ctx, t.peekBuried)
+}
+
+func (t *Tube) peekBuried(ctx context.Context) (id uint64, body []byte, err error) {
+	r, err := t.Conn.cmd(ctx, t, nil, nil, "peek-buried")
 	if err != nil {
 		return 0, nil, err
 	}
 	var args [1]uint64
-	body, err = t.Conn.readRespArgs(r, true, "FOUND", args[:])
+	body, err = t.Conn.readRespArgs(ctx, r, true, "FOUND", args[:])
 	if err != nil {
 		return 0, nil, err
 	}
@@ -134,12 +340,17 @@ func (t *Tube) PeekBuried() (id uint64, body []byte, err error) {
 // the ready queue, then returns the number of jobs moved. Jobs will be
 // taken in the order in which they were last buried.
 func (t *Tube) Kick(bound uint64) (n uint64, err error) {
-	r, err := t.Conn.cmd(t, nil, nil, "kick", bound)
+	return t.KickContext(context.Background(), bound)
+}
+
+// KickContext is like Kick, but takes a context.
+func (t *Tube) KickContext(ctx context.Context, bound uint64) (n uint64, err error) {
+	r, err := t.Conn.cmd(ctx, t, nil, nil, "kick", bound)
 	if err != nil {
 		return 0, err
 	}
 	var args [1]uint64
-	_, err = t.Conn.readRespArgs(r, false, "KICKED", args[:])
+	_, err = t.Conn.readRespArgs(ctx, r, false, "KICKED", args[:])
 	if err != nil {
 		return 0, err
 	}
@@ -148,11 +359,25 @@ func (t *Tube) Kick(bound uint64) (n uint64, err error) {
 
 // Stats retrieves statistics about tube t.
 func (t *Tube) Stats() (TubeStats, error) {
-	r, err := t.Conn.cmdTube(nil, nil, nil, "stats-tube", t.Name)
+	return t.StatsContext(context.Background())
+}
+
+// StatsContext is like Stats, but takes a context.
+func (t *Tube) StatsContext(ctx context.Context) (TubeStats, error) {
+	var res TubeStats
+	err := t.Conn.idempotent(func() (err error) {
+		res, err = t.stats(ctx)
+		return err
+	})
+	return res, err
+}
+
+func (t *Tube) stats(ctx context.Context) (TubeStats, error) {
+	r, err := t.Conn.cmdTube(ctx, nil, nil, nil, "stats-tube", t.Name)
 	if err != nil {
 		return TubeStats{}, err
 	}
-	body, err := t.Conn.readResp(r, true, "OK")
+	body, err := t.Conn.readResp(ctx, r, true, "OK")
 	if err != nil {
 		return TubeStats{}, err
 	}
@@ -181,11 +406,16 @@ func (t *Tube) Stats() (TubeStats, error) {
 
 // Pause pauses new reservations in t for time d.
 func (t *Tube) Pause(d time.Duration) error {
-	r, err := t.Conn.cmdTube(nil, nil, nil, "pause-tube", t.Name, dur(d))
+	return t.PauseContext(context.Background(), d)
+}
+
+// PauseContext is like Pause, but takes a context.
+func (t *Tube) PauseContext(ctx context.Context, d time.Duration) error {
+	r, err := t.Conn.cmdTube(ctx, nil, nil, nil, "pause-tube", t.Name, dur(d))
 	if err != nil {
 		return err
 	}
-	_, err = t.Conn.readResp(r, false, "PAUSED")
+	_, err = t.Conn.readResp(ctx, r, false, "PAUSED")
 	if err != nil {
 		return err
 	}
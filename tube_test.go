@@ -38,6 +38,23 @@ func TestTubePutBuried(t *testing.T) {
 	}
 }
 
+func TestTubePutAt(t *testing.T) {
+	s := newMockServer()
+	c := s.Conn()
+	defer c.Close()
+	id, err := c.PutAt([]byte("foo"), time.Now().Add(1500*time.Millisecond), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := s.job(id).delay; d != 2 {
+		t.Fatal("expected delay rounded up to 2, got", d)
+	}
+	id, _ = c.PutAt([]byte("foo"), time.Now().Add(-time.Hour), 0, 0)
+	if s.job(id).state != "ready" {
+		t.Fatal("expected job at a past time to be ready")
+	}
+}
+
 func TestTubePeekReady(t *testing.T) {
 	c := NewConn(mock("peek-ready\r\n", "FOUND 1 1\r\nx\r\n"))
 
@@ -1,6 +1,8 @@
 package beanstalk
 
 import (
+	"context"
+	"io"
 	"time"
 )
 
@@ -22,19 +24,146 @@ func NewTubeSet(c *Conn, name ...string) *TubeSet {
 
 // Reserve reserves and returns a job from one of the tubes in t. If no
 // job is available before time timeout has passed, Reserve returns a
-// ConnError recording ErrTimeout.
+// ConnError recording ErrTimeout. If the body of the job cannot be
+// decoded, Reserve buries or releases the job as described by
+// DecodeError, and returns its id with the DecodeError.
 //
 // Typically, a client will reserve a job, perform some work, then delete
 // the job with Conn.Delete.
 func (t *TubeSet) Reserve(timeout time.Duration) (id uint64, body []byte, err error) {
-	r, err := t.Conn.cmd(nil, t, nil, "reserve-with-timeout", dur(timeout))
+	return t.ReserveContext(context.Background(), timeout)
+}
+
+// ReserveContext is like Reserve, but takes a context.
+func (t *TubeSet) ReserveContext(ctx context.Context, timeout time.Duration) (id uint64, body []byte, err error) {
+	return t.ReserveIntoContext(ctx, timeout, nil)
+}
+
+// ReserveInto is like Reserve, but reads the body into dst if it is
+// large enough, so that the returned body aliases dst. Otherwise a new
+// slice is allocated, as by Reserve.
+func (t *TubeSet) ReserveInto(timeout time.Duration, dst []byte) (id uint64, body []byte, err error) {
+	return t.ReserveIntoContext(context.Background(), timeout, dst)
+}
+
+// ReserveIntoContext is like ReserveInto, but takes a context.
+func (t *TubeSet) ReserveIntoContext(ctx context.Context, timeout time.Duration, dst []byte) (id uint64, body []byte, err error) {
+	id, body, err = t.reserveSink(ctx, timeout, bodySink{dst: dst})
+	if err != nil {
+		return 0, nil, err
+	}
+	if _, body, err = t.Conn.decodeReserved(ctx, id, body); err != nil {
+		return id, nil, err
+	}
+	return id, body, nil
+}
+
+// ReserveTo is like Reserve, but copies the body to w as it is read
+// from the connection, without buffering it whole. An error from w is
+// returned as is, along with the id of the job, which stays reserved;
+// the Conn remains usable. The body is copied as stored, without
+// undoing envelopes or Transformers.
+func (t *TubeSet) ReserveTo(timeout time.Duration, w io.Writer) (id uint64, err error) {
+	return t.ReserveToContext(context.Background(), timeout, w)
+}
+
+// ReserveToContext is like ReserveTo, but takes a context.
+func (t *TubeSet) ReserveToContext(ctx context.Context, timeout time.Duration, w io.Writer) (id uint64, err error) {
+	sw := &sinkWriter{w: w}
+	if id, _, err = t.reserveSink(ctx, timeout, bodySink{w: sw}); err != nil {
+		return 0, err
+	}
+	return id, sw.err
+}
+
+func (t *TubeSet) reserveSink(ctx context.Context, timeout time.Duration, sink bodySink) (id uint64, body []byte, err error) {
+	r, err := t.Conn.cmd(ctx, nil, t, nil, "reserve-with-timeout", dur(timeout))
 	if err != nil {
 		return 0, nil, err
 	}
+	r.block = timeout
+	r.sink = sink
 	var args [1]uint64
-	body, err = t.Conn.readRespArgs(r, true, "RESERVED", args[:])
+	body, err = t.Conn.readRespArgs(ctx, r, true, "RESERVED", args[:])
 	if err != nil {
 		return 0, nil, err
 	}
 	return args[0], body, nil
 }
+
+// NextJob is like Reserve, but returns the job as a Job. If t names
+// more than one tube, NextJob looks up the tube of the job with
+// Conn.StatsJob.
+func (t *TubeSet) NextJob(timeout time.Duration) (*Job, error) {
+	return t.NextJobContext(context.Background(), timeout)
+}
+
+// NextJobContext is like NextJob, but takes a context.
+func (t *TubeSet) NextJobContext(ctx context.Context, timeout time.Duration) (*Job, error) {
+	j, err := t.nextJob(ctx, timeout)
+	if err != nil {
+		return nil, err
+	}
+	if len(t.Name) == 1 {
+		for name := range t.Name {
+			j.Tube = name
+		}
+		return j, nil
+	}
+	stats, err := t.Conn.StatsJobContext(ctx, j.Id)
+	if err != nil {
+		// The job stays reserved; return it so the caller can settle it.
+		return j, err
+	}
+	j.Tube = stats.Tube
+	return j, nil
+}
+
+// nextJob reserves a job from t and decodes it, without looking up its
+// tube.
+func (t *TubeSet) nextJob(ctx context.Context, timeout time.Duration) (*Job, error) {
+	id, body, err := t.reserveSink(ctx, timeout, bodySink{})
+	if err != nil {
+		return nil, err
+	}
+	h, body, err := t.Conn.decodeReserved(ctx, id, body)
+	if err != nil {
+		return nil, err
+	}
+	return &Job{Id: id, Body: body, Header: h, Conn: t.Conn, ReservedAt: time.Now()}, nil
+}
+
+// ReserveAsync is like Reserve, but returns as soon as the command has
+// been sent. The reserved job is delivered through the Future.
+func (t *TubeSet) ReserveAsync(timeout time.Duration) *Future {
+	r, err := t.Conn.cmd(context.Background(), nil, t, nil, "reserve-with-timeout", dur(timeout))
+	r.block = timeout
+	return t.Conn.async(r, err, t.Conn.readAsync(true, "RESERVED", true))
+}
+
+// ReserveBlocking is like Reserve, but waits for a job for as long as
+// it takes, using the reserve command rather than
+// reserve-with-timeout. It can still fail with a ConnError recording
+// ErrDeadline if a job reserved by the same connection is about to
+// exceed its TTR.
+func (t *TubeSet) ReserveBlocking() (id uint64, body []byte, err error) {
+	return t.ReserveBlockingContext(context.Background())
+}
+
+// ReserveBlockingContext is like ReserveBlocking, but takes a context.
+func (t *TubeSet) ReserveBlockingContext(ctx context.Context) (id uint64, body []byte, err error) {
+	r, err := t.Conn.cmd(ctx, nil, t, nil, "reserve")
+	if err != nil {
+		return 0, nil, err
+	}
+	r.block = -1
+	var args [1]uint64
+	body, err = t.Conn.readRespArgs(ctx, r, true, "RESERVED", args[:])
+	if err != nil {
+		return 0, nil, err
+	}
+	if _, body, err = t.Conn.decodeReserved(ctx, args[0], body); err != nil {
+		return args[0], nil, err
+	}
+	return args[0], body, nil
+}
@@ -1,6 +1,7 @@
 package beanstalk
 
 import (
+	"bytes"
 	"testing"
 	"time"
 )
@@ -38,3 +39,114 @@ func TestTubeSetReserveTimeout(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestTubeSetReserveBlocking(t *testing.T) {
+	c := NewConn(mock("reserve\r\n", "RESERVED 1 1\r\nx\r\n"))
+	id, body, err := c.ReserveBlocking()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 1 {
+		t.Fatal("expected 1, got", id)
+	}
+	if len(body) != 1 || body[0] != 'x' {
+		t.Fatalf("bad body, expected %#v, got %#v", "x", string(body))
+	}
+	if err = c.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTubeSetReserveBlockingWatch(t *testing.T) {
+	c := NewConn(mock(
+		"watch foo\r\nignore default\r\nreserve\r\n",
+		"WATCHING 2\r\nWATCHING 1\r\nRESERVED 1 1\r\nx\r\n",
+	))
+	id, _, err := NewTubeSet(c, "foo").ReserveBlocking()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 1 {
+		t.Fatal("expected 1, got", id)
+	}
+	if err = c.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTubeSetReserveBlockingDeadline(t *testing.T) {
+	c := NewConn(mock("reserve\r\n", "DEADLINE_SOON\r\n"))
+	_, _, err := c.ReserveBlocking()
+	if cerr, ok := err.(ConnError); !ok || cerr.Err != ErrDeadline {
+		t.Fatal("expected ErrDeadline, got", err)
+	}
+	if err = c.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTubeSetReserveTimeoutDeadline(t *testing.T) {
+	c := NewConn(mock("reserve-with-timeout 1\r\n", "DEADLINE_SOON\r\n"))
+	_, _, err := c.Reserve(time.Second)
+	if cerr, ok := err.(ConnError); !ok || cerr.Err != ErrDeadline {
+		t.Fatal("expected ErrDeadline, got", err)
+	}
+	if err = c.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTubeSetReserveBodySurvivesLaterCommands(t *testing.T) {
+	c := NewConn(mock(
+		"reserve-with-timeout 1\r\npeek 2\r\n",
+		"RESERVED 1 3\r\nabc\r\nFOUND 2 3\r\nxyz\r\n",
+	))
+	_, body, err := c.Reserve(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.Peek(2); err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "abc" {
+		t.Fatalf("body overwritten: got %q", body)
+	}
+}
+
+func TestTubeSetReserveInto(t *testing.T) {
+	c := NewConn(mock("reserve-with-timeout 1\r\n", "RESERVED 1 3\r\nabc\r\n"))
+	dst := make([]byte, 0, 8)
+	id, body, err := c.ReserveInto(time.Second, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 1 || string(body) != "abc" || &body[0] != &dst[:1][0] {
+		t.Fatalf("expected body in dst, got %d %q", id, body)
+	}
+}
+
+func TestTubeSetReserveTo(t *testing.T) {
+	c := NewConn(mock("reserve-with-timeout 1\r\n", "RESERVED 1 3\r\nabc\r\n"))
+	var b bytes.Buffer
+	id, err := c.ReserveTo(time.Second, &b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 1 || b.String() != "abc" {
+		t.Fatalf("got %d %q", id, b.String())
+	}
+}
+
+func TestTubeSetReserveToWriterError(t *testing.T) {
+	c := NewConn(mock(
+		"reserve-with-timeout 1\r\ndelete 1\r\n",
+		"RESERVED 1 3\r\nabc\r\nDELETED\r\n",
+	))
+	id, err := c.ReserveTo(time.Second, &failWriter{n: 2})
+	if err == nil || id != 1 {
+		t.Fatal("expected writer error with id 1, got", id, err)
+	}
+	if err = c.Delete(id); err != nil {
+		t.Fatal("expected Conn to stay usable, got", err)
+	}
+}
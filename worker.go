@@ -0,0 +1,478 @@
+package beanstalk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// DefaultReserveTimeout is the default timeout of the reserve commands
+// sent by a Worker.
+const DefaultReserveTimeout = 5 * time.Second
+
+// DefaultRetryDelay is the default delay with which a Worker without a
+// RetryPolicy releases a job that failed with a retryable error.
+const DefaultRetryDelay = 5 * time.Second
+
+// DefaultDrainBackoff is the default time a Worker waits before dialing
+// again after its server has reported that it is draining.
+const DefaultDrainBackoff = 10 * time.Second
+
+// ErrWorkerClosed is returned by Worker.Run after Worker.Shutdown.
+var ErrWorkerClosed = errors.New("beanstalk: worker closed")
+
+// A Handler processes a job reserved by a Worker. If it returns nil,
+// the job is deleted. If it returns an error wrapped by Permanent, the
+// job is buried, or moved to a dead-letter tube if the Worker has one.
+// If it returns any other error, the job is released to be tried
+// again, as long as the Worker's RetryPolicy allows. The context is
+// canceled when the Worker stops.
+type Handler func(ctx context.Context, j *Job) error
+
+// Permanent wraps err to tell a Worker that the job failed in a way
+// that retrying cannot fix, so it should be given up on rather than
+// released.
+func Permanent(err error) error {
+	return permanentError{err}
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e permanentError) Unwrap() error {
+	return e.err
+}
+
+func isPermanent(err error) bool {
+	var p permanentError
+	return errors.As(err, &p)
+}
+
+// A Worker reserves jobs from a set of tubes and passes each one to the
+// Handler registered for its tube, in Concurrency goroutines that each
+// have their own Conn. It deletes, releases or buries each job
+// according to the outcome of the Handler; a Handler that panics has
+// its job buried and the panic logged with its stack. Jobs are kept
+// alive with Conn.KeepAlive while their Handler runs.
+//
+// The configuration fields must not be changed after Run is called.
+type Worker struct {
+	// Dial opens the Conn for each goroutine.
+	Dial func(ctx context.Context) (*Conn, error)
+
+	// Concurrency is the number of jobs processed at once. If it is
+	// zero, one job is processed at a time.
+	Concurrency int
+
+	// ReserveTimeout is the timeout of each reserve command. If it is
+	// zero, DefaultReserveTimeout is used.
+	ReserveTimeout time.Duration
+
+	// RetryPolicy decides the delay with which a job that failed with
+	// a retryable error is released, and when to give up on it and
+	// bury it instead. If it is nil, the job is always released with
+	// RetryDelay.
+	RetryPolicy RetryPolicy
+
+	// RetryDelay is the delay with which a job that failed with a
+	// retryable error is released when there is no RetryPolicy. If it
+	// is zero, DefaultRetryDelay is used.
+	RetryDelay time.Duration
+
+	// DialFallback, if not nil, opens the Conn of a goroutine whose
+	// server has reported that it is draining, in place of Dial. If
+	// it is nil, the goroutine goes back to the same server after
+	// backing off; a draining server still hands out the jobs it has.
+	DialFallback func(ctx context.Context) (*Conn, error)
+
+	// DrainBackoff is how long a goroutine waits before dialing again
+	// when its server is draining. If it is zero,
+	// DefaultDrainBackoff is used.
+	DrainBackoff time.Duration
+
+	// DeadLetter, if not nil, maps the tube of a job that is given
+	// up on, because its Handler failed permanently or it ran out of
+	// retries, to the dead-letter tube where it is moved instead of
+	// being buried; see Job.DeadLetter. DeadLetterTube is a
+	// typical value.
+	DeadLetter func(tube string) string
+
+	// ErrorLog logs failures of Handlers and of the commands the
+	// Worker sends. If it is nil, the standard logger is used.
+	ErrorLog *log.Logger
+
+	mu       sync.Mutex
+	handlers map[string]Handler
+	inflight map[*flight]struct{}
+	shutdown bool
+	quit     chan struct{} // closed by Shutdown
+	active   sync.WaitGroup
+}
+
+// NewWorker returns a new Worker that dials addr on the given network
+// for each of its goroutines, with a timeout of DefaultDialTimeout.
+func NewWorker(network, addr string) *Worker {
+	return &Worker{
+		Dial: func(ctx context.Context) (*Conn, error) {
+			return dialContext(ctx, network, addr, DefaultDialTimeout)
+		},
+	}
+}
+
+// Handle registers h to process the jobs in tube. It panics if tube is
+// not a valid name.
+func (w *Worker) Handle(tube string, h Handler) {
+	if err := CheckName(tube); err != nil {
+		panic("beanstalk: " + err.Error())
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.handlers == nil {
+		w.handlers = make(map[string]Handler)
+	}
+	w.handlers[tube] = h
+}
+
+// Run processes jobs from the tubes with registered Handlers until ctx
+// is done or Shutdown is called. When ctx is done, the contexts of the
+// running Handlers are canceled, and Run waits for them to return and
+// returns ctx.Err(). After Shutdown, Run returns ErrWorkerClosed.
+func (w *Worker) Run(ctx context.Context) error {
+	w.mu.Lock()
+	if w.shutdown {
+		w.mu.Unlock()
+		return ErrWorkerClosed
+	}
+	tubes := make([]string, 0, len(w.handlers))
+	for tube := range w.handlers {
+		tubes = append(tubes, tube)
+	}
+	if len(tubes) == 0 {
+		w.mu.Unlock()
+		return errors.New("beanstalk: worker has no handlers")
+	}
+	n := w.Concurrency
+	if n <= 0 {
+		n = 1
+	}
+	w.active.Add(n)
+	quit := w.quitChan()
+	w.mu.Unlock()
+
+	// rctx governs reserving new jobs, which stops on Shutdown as well.
+	rctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-quit:
+			cancel()
+		case <-rctx.Done():
+		}
+	}()
+
+	for i := 0; i < n; i++ {
+		go func() {
+			defer w.active.Done()
+			w.work(ctx, rctx, tubes)
+		}()
+	}
+	w.active.Wait()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return ErrWorkerClosed
+}
+
+// Shutdown stops w from reserving new jobs and waits for the running
+// Handlers to return, or for ctx to be done. In the latter case, the
+// contexts of the Handlers still running are canceled and ctx.Err() is
+// returned. The Conns of their jobs are closed, so the server gives
+// the jobs back with their original priority, and whatever those
+// Handlers do afterwards through those Conns fails.
+func (w *Worker) Shutdown(ctx context.Context) error {
+	w.mu.Lock()
+	if !w.shutdown {
+		w.shutdown = true
+		close(w.quitChan())
+	}
+	w.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		w.active.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+
+	w.mu.Lock()
+	abandoned := make([]*flight, 0, len(w.inflight))
+	for f := range w.inflight {
+		f.abandoned = true
+		delete(w.inflight, f)
+		abandoned = append(abandoned, f)
+	}
+	w.mu.Unlock()
+	for _, f := range abandoned {
+		f.cancel()
+		// Closing the Conn, rather than releasing the job on it, keeps
+		// a Handler that has not noticed the cancellation from deleting
+		// or burying the job once it is no longer ours.
+		w.finish(f.j, f.j.Conn.Close())
+	}
+	return ctx.Err()
+}
+
+// quitChan returns the channel closed by Shutdown. w.mu must be held.
+func (w *Worker) quitChan() chan struct{} {
+	if w.quit == nil {
+		w.quit = make(chan struct{})
+	}
+	return w.quit
+}
+
+// A flight is a job whose Handler is running.
+type flight struct {
+	j         *Job
+	cancel    context.CancelFunc
+	abandoned bool // given back by Shutdown; guarded by Worker.mu
+}
+
+// work reserves and processes jobs on its own Conn until rctx is done.
+// Handlers run with contexts derived from ctx.
+func (w *Worker) work(ctx, rctx context.Context, tubes []string) {
+	var c *Conn
+	defer func() {
+		if c != nil {
+			c.Close()
+		}
+	}()
+	timeout := w.ReserveTimeout
+	if timeout <= 0 {
+		timeout = DefaultReserveTimeout
+	}
+	dial := w.Dial
+	backoff := DefaultMinBackoff
+	for rctx.Err() == nil {
+		if c == nil {
+			var err error
+			c, err = dial(rctx)
+			if err != nil {
+				w.logf("beanstalk: worker: dial: %v", err)
+				sleep(rctx, backoff)
+				if backoff *= 2; backoff > DefaultMaxBackoff {
+					backoff = DefaultMaxBackoff
+				}
+				continue
+			}
+			backoff = DefaultMinBackoff
+		}
+		j, stats, err := w.reserve(rctx, NewTubeSet(c, tubes...), timeout)
+		if err == nil {
+			if !w.process(ctx, j, stats) {
+				continue
+			}
+			err = ErrDraining
+		}
+		if rctx.Err() != nil {
+			return
+		}
+		switch {
+		case errors.Is(err, ErrDraining):
+			w.logf("beanstalk: worker: server is draining")
+			c.Close()
+			c = nil
+			sleep(rctx, w.drainBackoff())
+			if w.DialFallback != nil {
+				dial = w.DialFallback
+			}
+		case !c.usable() || isIOError(err):
+			w.logf("beanstalk: worker: %v", err)
+			c.Close()
+			c = nil
+		case errors.Is(err, ErrTimeout), errors.Is(err, ErrDeadline):
+		default:
+			w.logf("beanstalk: worker: %v", err)
+		}
+	}
+}
+
+func (w *Worker) drainBackoff() time.Duration {
+	if w.DrainBackoff > 0 {
+		return w.DrainBackoff
+	}
+	return DefaultDrainBackoff
+}
+
+// reserve reserves a job from ts and looks up its statistics.
+func (w *Worker) reserve(ctx context.Context, ts *TubeSet, timeout time.Duration) (*Job, JobStats, error) {
+	j, err := ts.nextJob(ctx, timeout)
+	if err != nil {
+		return nil, JobStats{}, err
+	}
+	backoff := DefaultMinBackoff
+	for i := 1; ; i++ {
+		var stats JobStats
+		stats, err = j.StatsContext(ctx)
+		if err == nil {
+			j.Tube = stats.Tube
+			return j, stats, nil
+		}
+		if i == statsAttempts || ctx.Err() != nil || !j.Conn.usable() || errors.Is(err, ErrNotFound) {
+			break
+		}
+		sleep(ctx, backoff)
+		backoff *= 2
+	}
+	// Without its tube the job cannot be handled, and without its
+	// priority it cannot be released as it was, so bury it at the
+	// lowest priority for someone to look at. A job reserved on a
+	// broken connection, or when ctx is done, is given back by the
+	// server when work closes the connection.
+	if ctx.Err() == nil && j.Conn.usable() && !errors.Is(err, ErrNotFound) {
+		w.logf("beanstalk: worker: burying job %d: %v", j.Id, err)
+		w.finish(j, j.Bury(math.MaxUint32))
+	}
+	return nil, JobStats{}, err
+}
+
+// statsAttempts is the number of times a Worker asks for the
+// statistics of a job it reserved before giving up on it.
+const statsAttempts = 3
+
+// process runs the Handler for j and deletes, releases or buries j
+// according to its outcome. It reports whether the Handler failed
+// because the server is draining.
+func (w *Worker) process(ctx context.Context, j *Job, stats JobStats) (draining bool) {
+	pri := uint32(stats.Pri)
+	w.mu.Lock()
+	h := w.handlers[j.Tube]
+	w.mu.Unlock()
+	if h == nil {
+		w.logf("beanstalk: worker: no handler for job %d from tube %s", j.Id, j.Tube)
+		w.finish(j, j.Release(pri, w.retryDelay()))
+		return false
+	}
+
+	hctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	f := &flight{j: j, cancel: cancel}
+	w.mu.Lock()
+	if w.inflight == nil {
+		w.inflight = make(map[*flight]struct{})
+	}
+	w.inflight[f] = struct{}{}
+	w.mu.Unlock()
+
+	ka := j.Conn.KeepAlive(j.Id, time.Duration(stats.Ttr)*time.Second)
+	err := w.call(hctx, h, j)
+	ka.Stop()
+
+	w.mu.Lock()
+	abandoned := f.abandoned
+	delete(w.inflight, f)
+	w.mu.Unlock()
+	if abandoned {
+		return false
+	}
+	if kerr := ka.Err(); kerr != nil {
+		w.logf("beanstalk: worker: lost job %d from tube %s: %v", j.Id, j.Tube, kerr)
+		return false
+	}
+	switch {
+	case err == nil:
+		err = j.Delete()
+	case isPermanent(err):
+		w.logf("beanstalk: worker: giving up on job %d from tube %s: %v", j.Id, j.Tube, err)
+		err = w.giveUp(j, pri, err)
+	default:
+		draining = errors.Is(err, ErrDraining)
+		if delay, ok := w.retry(stats); ok {
+			err = j.Release(pri, delay)
+		} else {
+			w.logf("beanstalk: worker: giving up on job %d from tube %s after %d attempts: %v", j.Id, j.Tube, Attempts(stats), err)
+			err = w.giveUp(j, pri, err)
+		}
+	}
+	w.finish(j, err)
+	return draining
+}
+
+// retry returns the delay with which to release a job that failed with
+// a retryable error, or ok false to give up on it.
+func (w *Worker) retry(stats JobStats) (delay time.Duration, ok bool) {
+	if w.RetryPolicy == nil {
+		return w.retryDelay(), true
+	}
+	return w.RetryPolicy.Retry(stats)
+}
+
+func (w *Worker) retryDelay() time.Duration {
+	if w.RetryDelay > 0 {
+		return w.RetryDelay
+	}
+	return DefaultRetryDelay
+}
+
+// giveUp moves j to its dead-letter tube, if w has one, or buries it,
+// recording reason as the cause.
+func (w *Worker) giveUp(j *Job, pri uint32, reason error) error {
+	if w.DeadLetter == nil {
+		return j.Bury(pri)
+	}
+	err := j.DeadLetter(w.DeadLetter(j.Tube), reason)
+	if err == nil || !j.Conn.usable() {
+		return err
+	}
+	w.logf("beanstalk: worker: dead-lettering job %d from tube %s: %v", j.Id, j.Tube, err)
+	return j.Bury(pri)
+}
+
+// call runs h for j, turning a panic into a permanent error.
+func (w *Worker) call(ctx context.Context, h Handler, j *Job) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			w.logf("beanstalk: worker: panic handling job %d from tube %s: %v\n%s", j.Id, j.Tube, v, debug.Stack())
+			err = Permanent(fmt.Errorf("panic: %v", v))
+		}
+	}()
+	return h(ctx, j)
+}
+
+// finish logs err, the result of the command that settled j.
+func (w *Worker) finish(j *Job, err error) {
+	if err != nil {
+		w.logf("beanstalk: worker: job %d: %v", j.Id, err)
+	}
+}
+
+func (w *Worker) logf(format string, args ...interface{}) {
+	if w.ErrorLog != nil {
+		w.ErrorLog.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
+
+// sleep pauses for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+	}
+}
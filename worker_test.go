@@ -0,0 +1,329 @@
+package beanstalk
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"math"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// runWorker runs w in the background and returns a function that stops
+// it and waits for Run to return.
+func runWorker(t *testing.T, w *Worker) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- w.Run(ctx) }()
+	return func() {
+		cancel()
+		if err := <-done; err != context.Canceled {
+			t.Fatal("expected context.Canceled, got", err)
+		}
+	}
+}
+
+func newTestWorker(s *mockServer, log *log.Logger) *Worker {
+	return &Worker{
+		Dial:           s.Dial,
+		ReserveTimeout: time.Second,
+		ErrorLog:       log,
+	}
+}
+
+func TestWorkerDelete(t *testing.T) {
+	s := newMockServer()
+	id := s.put("a", []byte("x"), 0, 0, 60)
+	w := newTestWorker(s, nil)
+	w.Handle("a", func(ctx context.Context, j *Job) error {
+		if j.Id != id || string(j.Body) != "x" || j.Tube != "a" {
+			t.Errorf("got job %d %q from %q", j.Id, j.Body, j.Tube)
+		}
+		return nil
+	})
+	stop := runWorker(t, w)
+	waitFor(t, func() bool { return s.job(id) == nil })
+	stop()
+}
+
+func TestWorkerRelease(t *testing.T) {
+	s := newMockServer()
+	id := s.put("a", []byte("x"), 7, 0, 60)
+	w := newTestWorker(s, nil)
+	w.RetryDelay = 2 * time.Second
+	w.Handle("a", func(ctx context.Context, j *Job) error {
+		return errors.New("try again")
+	})
+	stop := runWorker(t, w)
+	waitFor(t, func() bool { return s.job(id).state == "delayed" })
+	stop()
+
+	j := s.job(id)
+	if j.releases != 1 || j.delay != 2 || j.pri != 7 {
+		t.Fatalf("got releases=%d delay=%d pri=%d", j.releases, j.delay, j.pri)
+	}
+}
+
+func TestWorkerReleaseDefaultDelay(t *testing.T) {
+	s := newMockServer()
+	id := s.put("a", []byte("x"), 7, 0, 60)
+	w := newTestWorker(s, nil)
+	w.Handle("a", func(ctx context.Context, j *Job) error {
+		return errors.New("try again")
+	})
+	stop := runWorker(t, w)
+	waitFor(t, func() bool { return s.job(id).state == "delayed" })
+	stop()
+
+	if j := s.job(id); j.delay != uint64(DefaultRetryDelay/time.Second) {
+		t.Fatalf("got delay=%d, want %v", j.delay, DefaultRetryDelay)
+	}
+}
+
+func TestWorkerStatsFail(t *testing.T) {
+	s := newMockServer()
+	s.statsFail = true
+	id := s.put("a", []byte("x"), 7, 0, 60)
+	w := newTestWorker(s, log.New(new(bytes.Buffer), "", 0))
+	w.Handle("a", func(ctx context.Context, j *Job) error {
+		t.Error("handler called without stats")
+		return nil
+	})
+	stop := runWorker(t, w)
+	waitFor(t, func() bool { return s.job(id).state == "buried" })
+	stop()
+	if j := s.job(id); j.releases != 0 || j.pri != math.MaxUint32 {
+		t.Fatalf("expected the job to be buried at the lowest priority, got releases %d, pri %d", j.releases, j.pri)
+	}
+}
+
+func TestWorkerBury(t *testing.T) {
+	s := newMockServer()
+	id := s.put("a", []byte("x"), 7, 0, 60)
+	var buf bytes.Buffer
+	w := newTestWorker(s, log.New(&buf, "", 0))
+	w.Handle("a", func(ctx context.Context, j *Job) error {
+		return Permanent(errors.New("bad job"))
+	})
+	stop := runWorker(t, w)
+	waitFor(t, func() bool { return s.job(id).state == "buried" })
+	stop()
+
+	if j := s.job(id); j.buries != 1 || j.pri != 7 {
+		t.Fatalf("got buries=%d pri=%d", j.buries, j.pri)
+	}
+	if !strings.Contains(buf.String(), "bad job") {
+		t.Fatalf("expected error in log, got %q", buf.String())
+	}
+}
+
+func TestWorkerPanic(t *testing.T) {
+	s := newMockServer()
+	id := s.put("a", []byte("x"), 0, 0, 60)
+	var buf bytes.Buffer
+	w := newTestWorker(s, log.New(&buf, "", 0))
+	w.Handle("a", func(ctx context.Context, j *Job) error {
+		panic("boom")
+	})
+	stop := runWorker(t, w)
+	waitFor(t, func() bool { return s.job(id).state == "buried" })
+	stop()
+
+	if s := buf.String(); !strings.Contains(s, "panic") || !strings.Contains(s, "boom") || !strings.Contains(s, "goroutine") {
+		t.Fatalf("expected panic and stack in log, got %q", s)
+	}
+}
+
+func TestWorkerDispatch(t *testing.T) {
+	s := newMockServer()
+	for i := 0; i < 5; i++ {
+		s.put("a", []byte("a"), 0, 0, 60)
+		s.put("b", []byte("b"), 0, 0, 60)
+	}
+	s.put("c", []byte("c"), 0, 0, 60)
+	w := newTestWorker(s, nil)
+	w.Concurrency = 3
+	var (
+		mu  sync.Mutex
+		got = make(map[string]int)
+	)
+	h := func(ctx context.Context, j *Job) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if string(j.Body) != j.Tube {
+			t.Errorf("job from %q dispatched to handler for %q", j.Body, j.Tube)
+		}
+		got[j.Tube]++
+		return nil
+	}
+	w.Handle("a", h)
+	w.Handle("b", h)
+	stop := runWorker(t, w)
+	waitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return got["a"]+got["b"] == 10
+	})
+	stop()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if got["a"] != 5 || got["b"] != 5 || got["c"] != 0 {
+		t.Fatal("got", got)
+	}
+	if s.count("c", "ready") != 1 {
+		t.Fatal("expected job in unhandled tube to be left alone")
+	}
+}
+
+func TestWorkerKeepAlive(t *testing.T) {
+	s := newMockServer()
+	id := s.put("a", []byte("x"), 0, 0, 1)
+	w := newTestWorker(s, nil)
+	w.Handle("a", func(ctx context.Context, j *Job) error {
+		waitFor(t, func() bool { return s.job(id).touches > 0 })
+		return nil
+	})
+	stop := runWorker(t, w)
+	waitFor(t, func() bool { return s.job(id) == nil })
+	stop()
+}
+
+func TestWorkerShutdownWaits(t *testing.T) {
+	s := newMockServer()
+	id := s.put("a", []byte("x"), 0, 0, 60)
+	w := newTestWorker(s, nil)
+	started := make(chan struct{})
+	finish := make(chan struct{})
+	w.Handle("a", func(ctx context.Context, j *Job) error {
+		close(started)
+		<-finish
+		return nil
+	})
+	ran := make(chan error, 1)
+	go func() { ran <- w.Run(context.Background()) }()
+	<-started
+
+	shut := make(chan error, 1)
+	go func() { shut <- w.Shutdown(context.Background()) }()
+	select {
+	case err := <-shut:
+		t.Fatal("Shutdown returned early:", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(finish)
+	if err := <-shut; err != nil {
+		t.Fatal(err)
+	}
+	if err := <-ran; err != ErrWorkerClosed {
+		t.Fatal("expected ErrWorkerClosed, got", err)
+	}
+	if s.job(id) != nil {
+		t.Fatal("expected finished job to be deleted")
+	}
+	if err := w.Run(context.Background()); err != ErrWorkerClosed {
+		t.Fatal("expected ErrWorkerClosed, got", err)
+	}
+}
+
+func TestWorkerShutdownReleases(t *testing.T) {
+	s := newMockServer()
+	id := s.put("a", []byte("x"), 7, 0, 60)
+	w := newTestWorker(s, nil)
+	started := make(chan struct{})
+	canceled := make(chan struct{})
+	w.Handle("a", func(ctx context.Context, j *Job) error {
+		close(started)
+		<-ctx.Done()
+		close(canceled)
+		return nil // too late to delete the job
+	})
+	ran := make(chan error, 1)
+	go func() { ran <- w.Run(context.Background()) }()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := w.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Fatal("expected context.DeadlineExceeded, got", err)
+	}
+	<-canceled
+	if err := <-ran; err != ErrWorkerClosed {
+		t.Fatal("expected ErrWorkerClosed, got", err)
+	}
+	waitFor(t, func() bool { return s.job(id).state == "ready" })
+	if j := s.job(id); j.pri != 7 {
+		t.Fatalf("expected job given back with pri 7, got %+v", j)
+	}
+}
+
+func TestWorkerShutdownAbandonedHandler(t *testing.T) {
+	s := newMockServer()
+	id := s.put("a", []byte("x"), 7, 0, 60)
+	w := newTestWorker(s, log.New(new(bytes.Buffer), "", 0))
+	started := make(chan struct{})
+	deleted := make(chan error, 1)
+	release := make(chan struct{})
+	w.Handle("a", func(ctx context.Context, j *Job) error {
+		close(started)
+		<-release // ignore ctx
+		deleted <- j.Delete()
+		return nil
+	})
+	ran := make(chan error, 1)
+	go func() { ran <- w.Run(context.Background()) }()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := w.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Fatal("expected context.DeadlineExceeded, got", err)
+	}
+	waitFor(t, func() bool { return s.job(id).state == "ready" })
+	close(release)
+	if err := <-deleted; err == nil {
+		t.Fatal("expected the late delete to fail")
+	}
+	<-ran
+	if j := s.job(id); j == nil || j.state != "ready" {
+		t.Fatalf("expected job to survive the late delete, got %+v", j)
+	}
+}
+
+func TestWorkerDraining(t *testing.T) {
+	s1, s2 := newMockServer(), newMockServer()
+	s1.draining = true
+	id1 := s1.put("a", []byte("x"), 0, 0, 60)
+	id2 := s2.put("a", []byte("x"), 0, 0, 60)
+	var buf bytes.Buffer
+	w := newTestWorker(s1, log.New(&buf, "", 0))
+	w.DialFallback = s2.Dial
+	w.DrainBackoff = time.Millisecond
+	w.Handle("a", func(ctx context.Context, j *Job) error {
+		_, err := (&Tube{j.Conn, "b"}).Put([]byte("y"), 0, 0, 60)
+		return err
+	})
+	stop := runWorker(t, w)
+	waitFor(t, func() bool { return s2.job(id2) == nil })
+	stop()
+
+	if j := s1.job(id1); j == nil || j.state != "delayed" || j.releases != 1 {
+		t.Fatalf("expected job released on draining server, got %+v", j)
+	}
+	if s2.count("b", "ready") != 1 {
+		t.Fatal("expected job put on fallback server")
+	}
+	if !strings.Contains(buf.String(), "draining") {
+		t.Fatalf("expected draining in log, got %q", buf.String())
+	}
+}
+
+func TestWorkerNoHandlers(t *testing.T) {
+	w := newTestWorker(newMockServer(), nil)
+	if err := w.Run(context.Background()); err == nil {
+		t.Fatal("expected error")
+	}
+}